@@ -1,12 +1,13 @@
 package clause
 
 import (
+	"fmt"
 	"strings"
 )
 
 type Clause struct {
-	sql     [9]string
-	sqlVars [9][]any
+	sql     [numTypes]string
+	sqlVars [numTypes][]any
 }
 
 type Type int
@@ -21,6 +22,9 @@ const (
 	UPDATE
 	DELETE
 	COUNT
+	LOCKING
+	ONCONFLICT
+	numTypes
 )
 
 func (c *Clause) Set(name Type, vars ...any) {
@@ -29,11 +33,21 @@ func (c *Clause) Set(name Type, vars ...any) {
 	c.sqlVars[name] = vars
 }
 
+// And adds a condition to the WHERE clause, joined with AND to the existing one
+func (c *Clause) And(desc string, vars ...any) {
+	if c.sql[WHERE] == "" {
+		c.Set(WHERE, append([]any{desc}, vars...)...)
+		return
+	}
+	c.sql[WHERE] = fmt.Sprintf("WHERE (%s) AND %s", strings.TrimPrefix(c.sql[WHERE], "WHERE "), desc)
+	c.sqlVars[WHERE] = append(append([]any(nil), c.sqlVars[WHERE]...), vars...)
+}
+
 func (c *Clause) Build(orders ...Type) (string, []any) {
 	var sqls []string
 	var vars []any
 	for _, order := range orders {
-		if order < 9 && c.sql[order] != "" {
+		if order < numTypes && c.sql[order] != "" {
 			sqls = append(sqls, c.sql[order])
 			vars = append(vars, c.sqlVars[order]...)
 		}
@@ -42,6 +56,6 @@ func (c *Clause) Build(orders ...Type) (string, []any) {
 }
 
 func (c *Clause) Clear() {
-	c.sql = [9]string{}
-	c.sqlVars = [9][]any{}
+	c.sql = [numTypes]string{}
+	c.sqlVars = [numTypes][]any{}
 }
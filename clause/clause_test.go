@@ -2,6 +2,7 @@ package clause
 
 import (
 	"fmt"
+	"github.com/go-needle/orm/dialect"
 	"reflect"
 	"testing"
 	"time"
@@ -44,3 +45,64 @@ func TestTime(t *testing.T) {
 	}
 	fmt.Println(time.Since(start).String())
 }
+
+func TestJSONQuery(t *testing.T) {
+	sqlite3, _ := dialect.GetDialect("sqlite3")
+	postgres, _ := dialect.GetDialect("postgres")
+	expr := JSONQuery("settings", "$.theme").Equals("dark")
+	if sql, vars := expr.Build(sqlite3); sql != "json_extract(settings, '$.theme') = ?" || !reflect.DeepEqual(vars, []any{"dark"}) {
+		t.Fatal("failed to build sqlite3 json query, got", sql, vars)
+	}
+	if sql, _ := expr.Build(postgres); sql != "settings->>'theme' = ?" {
+		t.Fatal("failed to build postgres json query, got", sql)
+	}
+	if sql, _ := JSONQuery("settings", "$.ui.colors[0]").Equals("red").Build(postgres); sql != "settings#>>'{ui,colors,0}' = ?" {
+		t.Fatal("failed to build postgres nested json query, got", sql)
+	}
+}
+
+func TestLocking(t *testing.T) {
+	postgres, _ := dialect.GetDialect("postgres")
+	var clause Clause
+	clause.Set(SELECT, "Job", []string{"*"})
+	clause.Set(LIMIT, 1)
+	lock, _ := Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}.Build(postgres)
+	clause.Set(LOCKING, lock)
+	sql, _ := clause.Build(SELECT, WHERE, ORDERBY, LIMIT, LOCKING)
+	if sql != "SELECT * FROM Job LIMIT ? FOR UPDATE SKIP LOCKED" {
+		t.Fatal("failed to build locking clause, got", sql)
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	var clause Clause
+	clause.Set(INSERT, "User", []string{"ID", "Name"})
+	clause.Set(VALUES, []any{1, "Tom"})
+	sql, _ := OnConflict{Columns: []string{"ID"}, DoUpdates: []string{"Name"}}.Build(nil)
+	clause.Set(ONCONFLICT, sql)
+	sql, vars := clause.Build(INSERT, VALUES, ONCONFLICT)
+	if sql != "INSERT INTO User (ID,Name) VALUES (?, ?) ON CONFLICT (ID) DO UPDATE SET Name = excluded.Name" || len(vars) != 2 {
+		t.Fatal("failed to build on conflict clause, got", sql)
+	}
+	if sql, _ = (OnConflict{Columns: []string{"A", "B"}, DoNothing: true}).Build(nil); sql != "ON CONFLICT (A, B) DO NOTHING" {
+		t.Fatal("failed to build on conflict do nothing, got", sql)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	sqlite3, _ := dialect.GetDialect("sqlite3")
+	name := Column[string]{Name: "Name"}
+	age := Column[int]{Name: "Age"}
+	expr := Or(And(name.Eq("Tom"), age.Of("u").Gt(18)), Not(age.In(1, 2)), name.IsNull())
+	sql, vars := expr.Build(sqlite3)
+	if sql != "((Name = ?) AND (u.Age > ?)) OR (NOT (Age IN (?, ?))) OR (Name IS NULL)" ||
+		!reflect.DeepEqual(vars, []any{"Tom", 18, 1, 2}) {
+		t.Fatal("failed to build column conditions, got", sql, vars)
+	}
+	if sql, _ := age.In().Build(sqlite3); sql != "1 = 0" {
+		t.Fatal("failed to build an empty IN, got", sql)
+	}
+	if order := age.Of("User").Desc(); order != "User.Age DESC" {
+		t.Fatal("failed to build order, got", order)
+	}
+}
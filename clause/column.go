@@ -0,0 +1,121 @@
+package clause
+
+import (
+	"github.com/go-needle/orm/dialect"
+	"strings"
+)
+
+// Column is a column of a table holding values of type T, its methods build conditions accepting
+// only values of T, e.g. UserCols.Age.Gt(18). Columns of models are generated by orm-cols.
+type Column[T any] struct {
+	// Table qualifies the column if it is set, see Of
+	Table string
+	Name  string
+}
+
+// Of returns the column qualified by table, a table name or an alias, e.g. UserCols.Age.Of("u")
+// for u.Age, to tell apart the columns of joined tables
+func (c Column[T]) Of(table string) Column[T] {
+	c.Table = table
+	return c
+}
+
+// String returns the column, qualified by its table if it is set, e.g. Age or u.Age
+func (c Column[T]) String() string {
+	if c.Table == "" {
+		return c.Name
+	}
+	return c.Table + "." + c.Name
+}
+
+func (c Column[T]) compare(op string, value T) Expr {
+	return Expr{SQL: c.String() + " " + op + " ?", Vars: []any{value}}
+}
+
+func (c Column[T]) Eq(value T) Expr  { return c.compare("=", value) }
+func (c Column[T]) Neq(value T) Expr { return c.compare("<>", value) }
+func (c Column[T]) Gt(value T) Expr  { return c.compare(">", value) }
+func (c Column[T]) Gte(value T) Expr { return c.compare(">=", value) }
+func (c Column[T]) Lt(value T) Expr  { return c.compare("<", value) }
+func (c Column[T]) Lte(value T) Expr { return c.compare("<=", value) }
+
+// In matches rows whose column is one of values, none if values is empty
+func (c Column[T]) In(values ...T) Expr {
+	return c.in("IN", "1 = 0", values)
+}
+
+// NotIn matches rows whose column is none of values, all if values is empty
+func (c Column[T]) NotIn(values ...T) Expr {
+	return c.in("NOT IN", "1 = 1", values)
+}
+
+func (c Column[T]) in(op, empty string, values []T) Expr {
+	if len(values) == 0 {
+		return Expr{SQL: empty}
+	}
+	vars := make([]any, len(values))
+	for i, value := range values {
+		vars[i] = value
+	}
+	return Expr{SQL: c.String() + " " + op + " (" + genBindVars(len(values)) + ")", Vars: vars}
+}
+
+// Between matches rows whose column is between low and high, both included
+func (c Column[T]) Between(low, high T) Expr {
+	return Expr{SQL: c.String() + " BETWEEN ? AND ?", Vars: []any{low, high}}
+}
+
+// Like matches rows whose column matches pattern, e.g. Tom%
+func (c Column[T]) Like(pattern string) Expr {
+	return Expr{SQL: c.String() + " LIKE ?", Vars: []any{pattern}}
+}
+
+func (c Column[T]) IsNull() Expr    { return Expr{SQL: c.String() + " IS NULL"} }
+func (c Column[T]) IsNotNull() Expr { return Expr{SQL: c.String() + " IS NOT NULL"} }
+
+// Asc returns the ascending order of the column for OrderBy
+func (c Column[T]) Asc() string { return c.String() + " ASC" }
+
+// Desc returns the descending order of the column for OrderBy
+func (c Column[T]) Desc() string { return c.String() + " DESC" }
+
+// And matches rows matching all of exprs
+func And(exprs ...Expression) Expression {
+	return junction{op: " AND ", exprs: exprs}
+}
+
+// Or matches rows matching any of exprs
+func Or(exprs ...Expression) Expression {
+	return junction{op: " OR ", exprs: exprs}
+}
+
+// Not matches rows not matching expr
+func Not(expr Expression) Expression {
+	return not{expr: expr}
+}
+
+// junction joins expressions with AND or OR, each one in parentheses
+type junction struct {
+	op    string
+	exprs []Expression
+}
+
+func (j junction) Build(d dialect.Dialect) (string, []any) {
+	var sqls []string
+	var vars []any
+	for _, expr := range j.exprs {
+		sql, exprVars := expr.Build(d)
+		sqls = append(sqls, "("+sql+")")
+		vars = append(vars, exprVars...)
+	}
+	return strings.Join(sqls, j.op), vars
+}
+
+type not struct {
+	expr Expression
+}
+
+func (n not) Build(d dialect.Dialect) (string, []any) {
+	sql, vars := n.expr.Build(d)
+	return "NOT (" + sql + ")", vars
+}
@@ -0,0 +1,96 @@
+package clause
+
+import (
+	"github.com/go-needle/orm/dialect"
+	"strings"
+)
+
+// Expression is a condition rendered for a dialect, it can be passed to Session.Where
+type Expression interface {
+	Build(d dialect.Dialect) (string, []any)
+}
+
+// Interface is a clause which takes its own slot in a statement, see Session.Clauses
+type Interface interface {
+	Expression
+	Type() Type
+}
+
+// Locking locks the selected rows, e.g. Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+// renders FOR UPDATE SKIP LOCKED on dialects supporting it
+type Locking struct {
+	// Strength is UPDATE or SHARE
+	Strength string
+	// Options is NOWAIT or SKIP LOCKED, it may be empty
+	Options string
+}
+
+func (l Locking) Type() Type {
+	return LOCKING
+}
+
+func (l Locking) Build(d dialect.Dialect) (string, []any) {
+	return dialect.LockingClause(d, l.Strength, l.Options), nil
+}
+
+// OnConflict handles inserted rows conflicting with a unique constraint on Columns,
+// they are either skipped with DoNothing or the DoUpdates columns are overwritten
+type OnConflict struct {
+	Columns   []string
+	DoNothing bool
+	DoUpdates []string
+}
+
+func (c OnConflict) Type() Type {
+	return ONCONFLICT
+}
+
+func (c OnConflict) Build(dialect.Dialect) (string, []any) {
+	var sql strings.Builder
+	sql.WriteString("ON CONFLICT")
+	if len(c.Columns) > 0 {
+		sql.WriteString(" (" + strings.Join(c.Columns, ", ") + ")")
+	}
+	if c.DoNothing || len(c.DoUpdates) == 0 {
+		sql.WriteString(" DO NOTHING")
+		return sql.String(), nil
+	}
+	var sets []string
+	for _, column := range c.DoUpdates {
+		sets = append(sets, column+" = excluded."+column)
+	}
+	sql.WriteString(" DO UPDATE SET " + strings.Join(sets, ", "))
+	return sql.String(), nil
+}
+
+// Expr is a raw SQL expression with its bind vars
+type Expr struct {
+	SQL  string
+	Vars []any
+}
+
+func (e Expr) Build(dialect.Dialect) (string, []any) {
+	return e.SQL, e.Vars
+}
+
+// JSONQueryExpression compares a value inside a JSON column
+type JSONQueryExpression struct {
+	column string
+	path   string
+	value  any
+}
+
+// JSONQuery selects the value at path, e.g. $.theme, in a JSON column
+func JSONQuery(column, path string) JSONQueryExpression {
+	return JSONQueryExpression{column: column, path: path}
+}
+
+// Equals matches rows whose value at the path equals value
+func (j JSONQueryExpression) Equals(value any) JSONQueryExpression {
+	j.value = value
+	return j
+}
+
+func (j JSONQueryExpression) Build(d dialect.Dialect) (string, []any) {
+	return dialect.JSONExtract(d, j.column, j.path) + " = ?", []any{j.value}
+}
@@ -2,6 +2,7 @@ package clause
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -20,6 +21,8 @@ func init() {
 	generators[UPDATE] = _update
 	generators[DELETE] = _delete
 	generators[COUNT] = _count
+	generators[LOCKING] = _locking
+	generators[ONCONFLICT] = _onConflict
 }
 
 func genBindVars(num int) string {
@@ -60,9 +63,10 @@ func _values(values ...any) (string, []any) {
 
 func _select(values ...any) (string, []any) {
 	// SELECT $fields FROM $tableName
+	// the rest of values are bound to placeholders in $tableName, e.g. in JOIN ... ON
 	tableName := values[0].(string)
 	fields := strings.Join(values[1].([]string), ", ")
-	return fmt.Sprintf("SELECT %v FROM %s", fields, tableName), []any{}
+	return fmt.Sprintf("SELECT %v FROM %s", fields, tableName), values[2:]
 }
 
 func _limit(values ...any) (string, []any) {
@@ -83,9 +87,22 @@ func _orderBy(values ...any) (string, []any) {
 func _update(values ...any) (string, []any) {
 	tableName := values[0].(string)
 	m := values[1].(map[string]any)
+	// columns are set in order, so that the statement is the same each time
+	columns := make([]string, 0, len(m))
+	for k := range m {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
 	var keys []string
 	var vars []any
-	for k, v := range m {
+	for _, k := range columns {
+		v := m[k]
+		// an Expr is set as it is, e.g. version = version + 1
+		if expr, ok := v.(Expr); ok {
+			keys = append(keys, k+" = "+expr.SQL)
+			vars = append(vars, expr.Vars...)
+			continue
+		}
 		keys = append(keys, k+" = ?")
 		vars = append(vars, v)
 	}
@@ -99,3 +116,13 @@ func _delete(values ...any) (string, []any) {
 func _count(values ...any) (string, []any) {
 	return _select(values[0], []string{"count(*)"})
 }
+
+func _locking(values ...any) (string, []any) {
+	// FOR UPDATE ..., rendered by the dialect
+	return values[0].(string), values[1:]
+}
+
+func _onConflict(values ...any) (string, []any) {
+	// ON CONFLICT ($columns) DO ..., rendered by OnConflict
+	return values[0].(string), values[1:]
+}
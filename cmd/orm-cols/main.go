@@ -0,0 +1,133 @@
+// Command orm-cols writes the typed columns of model structs, so that conditions on them are checked
+// at compile time, e.g. in the package of the models
+//
+//	//go:generate go run github.com/go-needle/orm/cmd/orm-cols -type User,Order -namer snake
+//
+// writes orm_cols.go declaring UserCols and OrderCols, see gen.Columns. The models are parsed by a
+// program importing their package, built in a temporary directory inside it.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	types := flag.String("type", "", "comma separated model types")
+	namer := flag.String("namer", "default", "naming strategy of the engine, default or snake")
+	plural := flag.Bool("plural", false, "pluralize table names, as schema.PluralNamer")
+	prefix := flag.String("prefix", "", "prefix of table names, as schema.PrefixNamer")
+	out := flag.String("o", "orm_cols.go", "output file")
+	flag.Parse()
+	if *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	namerExpr, err := namerExpression(*namer, *plural, *prefix)
+	if err == nil {
+		err = run(strings.Split(*types, ","), namerExpr, *out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "orm-cols:", err)
+		os.Exit(1)
+	}
+}
+
+// namerExpression returns the Go expression of the schema.Namer selected by the flags
+func namerExpression(name string, plural bool, prefix string) (string, error) {
+	var namer string
+	switch name {
+	case "default":
+		namer = "schema.DefaultNamer{}"
+	case "snake":
+		namer = "schema.SnakeNamer{}"
+	default:
+		return "", fmt.Errorf("unknown namer %s", name)
+	}
+	if plural {
+		namer = fmt.Sprintf("schema.PluralNamer{Namer: %s}", namer)
+	}
+	if prefix != "" {
+		namer = fmt.Sprintf("schema.PrefixNamer{Prefix: %q, Namer: %s}", prefix, namer)
+	}
+	return namer, nil
+}
+
+const program = `package main
+
+import (
+	"fmt"
+	"github.com/go-needle/orm/gen"
+	"github.com/go-needle/orm/schema"
+	"os"
+	models %q
+)
+
+func main() {
+	src, err := gen.Columns(%q, %s, %s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(src)
+}
+`
+
+func run(types []string, namer, out string) error {
+	list, err := exec.Command("go", "list", "-f", "{{.ImportPath}} {{.Name}}", ".").Output()
+	if err != nil {
+		return fmt.Errorf("can't find the package of the models: %w", err)
+	}
+	importPath, pkg, _ := strings.Cut(strings.TrimSpace(string(list)), " ")
+	if pkg == "main" {
+		return errors.New("models of package main can't be imported")
+	}
+	var models []string
+	for _, typ := range types {
+		models = append(models, "&models."+strings.TrimSpace(typ)+"{}")
+	}
+
+	// the columns written before may not compile anymore, e.g. once a type is renamed
+	previous, err := os.ReadFile(out)
+	if err == nil {
+		if err = os.Remove(out); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	src, err := generate(fmt.Sprintf(program, importPath, pkg, namer, strings.Join(models, ", ")))
+	if err != nil {
+		if previous != nil {
+			_ = os.WriteFile(out, previous, 0o644)
+		}
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
+
+// generate runs the program writing the columns in a temporary directory of the package
+func generate(program string) ([]byte, error) {
+	dir, err := os.MkdirTemp(".", ".orm-cols-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(program), 0o644); err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "run", "./"+filepath.Base(dir))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
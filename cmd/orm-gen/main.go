@@ -0,0 +1,62 @@
+// Command orm-gen writes model structs for the tables of an existing database, e.g.
+//
+//	orm-gen -dsn legacy.db -pkg models -o models/models.go
+//
+// The generated file is a starting point, review the types and associations before using it.
+// Only the sqlite3 driver is linked in, other databases need their driver imported here.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"github.com/go-needle/orm/gen"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"strings"
+)
+
+func main() {
+	driver := flag.String("driver", "sqlite3", "database driver and dialect")
+	dsn := flag.String("dsn", "", "data source name of the database")
+	pkg := flag.String("pkg", "models", "package of the generated file")
+	tables := flag.String("tables", "", "comma separated tables to generate, all of them if empty")
+	out := flag.String("o", "", "output file, standard output if empty")
+	flag.Parse()
+	if *dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*driver, *dsn, *pkg, *tables, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "orm-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(driver, dsn, pkg, tables, out string) error {
+	d, ok := dialect.GetDialect(driver)
+	if !ok {
+		return fmt.Errorf("dialect %s not found", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	config := gen.Config{Package: pkg}
+	if tables != "" {
+		for _, table := range strings.Split(tables, ",") {
+			config.Tables = append(config.Tables, strings.TrimSpace(table))
+		}
+	}
+	src, err := gen.Generate(db, d, config)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
@@ -1,14 +1,79 @@
 package dialect
 
-import "reflect"
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
 
 var dialectsMap = map[string]Dialect{}
 
+// Dialect is what a database must provide to be used, the features added since are provided by
+// optional interfaces, like Indexer and Introspector, so that existing dialects keep compiling.
+// The functions of this package calling them fall back to the syntax shared by SQLite and PostgreSQL.
 type Dialect interface {
 	DataTypeOf(typ reflect.Value) string
 	TableExistSQL(tableName string) (string, []any)
 }
 
+// Named is implemented by dialects knowing their name, custom column types are looked up by it
+type Named interface {
+	Name() string
+}
+
+// BindVarer is implemented by dialects whose placeholders aren't ?
+type BindVarer interface {
+	// BindVar returns the placeholder of the i-th bind var, counting from 1
+	BindVar(i int) string
+}
+
+// JSONExtractor is implemented by dialects querying JSON otherwise than json_extract
+type JSONExtractor interface {
+	// JSONExtract returns an expression selecting the text at a JSON path like $.a.b in column
+	JSONExtract(column, path string) string
+}
+
+// Locker is implemented by dialects locking rows
+type Locker interface {
+	// LockingClause returns the row locking clause appended to SELECT, e.g. FOR UPDATE SKIP LOCKED,
+	// it is empty if the dialect doesn't lock rows
+	LockingClause(strength, options string) string
+}
+
+// Indexer is implemented by dialects managing indexes
+type Indexer interface {
+	IndexExistSQL(tableName, indexName string) (string, []any)
+	// CreateIndexSQL returns the statement creating an index on columns of a table,
+	// a partial one covering the rows matching where if it isn't empty
+	CreateIndexSQL(tableName, indexName string, columns []string, unique bool, where string) string
+	DropIndexSQL(tableName, indexName string) string
+}
+
+// ForeignKeyer is implemented by dialects declaring foreign keys
+type ForeignKeyer interface {
+	// ForeignKeySQL returns the table constraint of a foreign key in CREATE TABLE,
+	// onDelete and onUpdate are referential actions like CASCADE, they may be empty
+	ForeignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate string) string
+}
+
+// Alterer is implemented by dialects changing columns in place
+type Alterer interface {
+	// AlterColumnSQL returns the statements changing a column to column,
+	// nil if the dialect can only do it by rebuilding the table
+	AlterColumnSQL(tableName string, column ColumnInfo) []string
+	// DropColumnSQL returns the statement dropping a column,
+	// empty if the dialect can only do it by rebuilding the table
+	DropColumnSQL(tableName, columnName string) string
+}
+
+// Literaler is implemented by dialects writing literals otherwise than Literal does by default
+type Literaler interface {
+	// Literal returns value, a bind var, as an SQL literal, to interpolate statements for logs
+	Literal(value any) string
+}
+
 func RegisterDialect(name string, dialect Dialect) {
 	dialectsMap[name] = dialect
 }
@@ -17,3 +82,230 @@ func GetDialect(name string) (dialect Dialect, ok bool) {
 	dialect, ok = dialectsMap[name]
 	return
 }
+
+// NameOf returns the name of d, the one it is registered with unless it is Named
+func NameOf(d Dialect) string {
+	if named, ok := d.(Named); ok {
+		return named.Name()
+	}
+	for name, registered := range dialectsMap {
+		if registered == d {
+			return name
+		}
+	}
+	return ""
+}
+
+// BindVar returns the placeholder of the i-th bind var of d, counting from 1
+func BindVar(d Dialect, i int) string {
+	if binder, ok := d.(BindVarer); ok {
+		return binder.BindVar(i)
+	}
+	return "?"
+}
+
+// JSONExtract returns the expression of d selecting the text at a JSON path like $.a.b in column
+func JSONExtract(d Dialect, column, path string) string {
+	if extractor, ok := d.(JSONExtractor); ok {
+		return extractor.JSONExtract(column, path)
+	}
+	return fmt.Sprintf("json_extract(%s, %s)", column, quoteString(path))
+}
+
+// LockingClause returns the row locking clause of d, empty if it doesn't lock rows
+func LockingClause(d Dialect, strength, options string) string {
+	if locker, ok := d.(Locker); ok {
+		return locker.LockingClause(strength, options)
+	}
+	return ""
+}
+
+// IndexExistSQL returns the query of whether an index exists, false if d can't tell
+func IndexExistSQL(d Dialect, tableName, indexName string) (string, []any, bool) {
+	if indexer, ok := d.(Indexer); ok {
+		sql, args := indexer.IndexExistSQL(tableName, indexName)
+		return sql, args, true
+	}
+	return "", nil, false
+}
+
+// CreateIndexSQL returns the statement of d creating an index, see Indexer
+func CreateIndexSQL(d Dialect, tableName, indexName string, columns []string, unique bool, where string) string {
+	if indexer, ok := d.(Indexer); ok {
+		return indexer.CreateIndexSQL(tableName, indexName, columns, unique, where)
+	}
+	return createIndexSQL(tableName, indexName, columns, unique, where)
+}
+
+// DropIndexSQL returns the statement of d dropping an index
+func DropIndexSQL(d Dialect, tableName, indexName string) string {
+	if indexer, ok := d.(Indexer); ok {
+		return indexer.DropIndexSQL(tableName, indexName)
+	}
+	return "DROP INDEX IF EXISTS " + indexName
+}
+
+// ForeignKeySQL returns the foreign key table constraint of d, see ForeignKeyer
+func ForeignKeySQL(d Dialect, name, column, refTable, refColumn, onDelete, onUpdate string) string {
+	if foreignKeyer, ok := d.(ForeignKeyer); ok {
+		return foreignKeyer.ForeignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate)
+	}
+	return foreignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate)
+}
+
+// AlterColumnSQL returns the statements of d changing a column, nil if the table must be rebuilt
+func AlterColumnSQL(d Dialect, tableName string, column ColumnInfo) []string {
+	if alterer, ok := d.(Alterer); ok {
+		return alterer.AlterColumnSQL(tableName, column)
+	}
+	return nil
+}
+
+// DropColumnSQL returns the statement of d dropping a column, empty if the table must be rebuilt
+func DropColumnSQL(d Dialect, tableName, columnName string) string {
+	if alterer, ok := d.(Alterer); ok {
+		return alterer.DropColumnSQL(tableName, columnName)
+	}
+	return ""
+}
+
+// Literal returns value, a bind var, as an SQL literal of d
+func Literal(d Dialect, value any) string {
+	if literaler, ok := d.(Literaler); ok {
+		return literaler.Literal(value)
+	}
+	return literal(d, value)
+}
+
+// Rebind replaces the ? placeholders of query with the bind vars of d,
+// placeholders inside quotes are left as they are
+func Rebind(d Dialect, query string) string {
+	if BindVar(d, 1) == "?" || !strings.Contains(query, "?") {
+		return query
+	}
+	var sb strings.Builder
+	var quote rune
+	n := 0
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			sb.WriteString(BindVar(d, n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Interpolate replaces the ? placeholders of query with vars as literals of d, e.g. to log it.
+// The result is for people to read, statements should be executed with bind vars.
+func Interpolate(d Dialect, query string, vars []any) string {
+	var sb strings.Builder
+	var quote rune
+	n := 0
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?' && n < len(vars):
+			sb.WriteString(Literal(d, vars[n]))
+			n++
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// literal returns value as an SQL literal of d in the syntax shared by SQLite and PostgreSQL,
+// bytes and bools are converted by the dialects beforehand
+func literal(d Dialect, value any) string {
+	if valuer, ok := value.(driver.Valuer); ok {
+		// a nil pointer to a type whose Value has a value receiver is NULL, as database/sql binds it
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer && rv.IsNil() &&
+			rv.Type().Elem().Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem()) {
+			return "NULL"
+		}
+		v, err := valuer.Value()
+		if err != nil {
+			return "?"
+		}
+		return Literal(d, v)
+	}
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteString(v)
+	case time.Time:
+		return quoteString(v.Format("2006-01-02 15:04:05.999999999-07:00"))
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return "NULL"
+		}
+		return Literal(d, v.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(value)
+	}
+	return quoteString(fmt.Sprint(value))
+}
+
+// createIndexSQL returns CREATE [UNIQUE] INDEX in the syntax shared by SQLite and PostgreSQL
+func createIndexSQL(tableName, indexName string, columns []string, unique bool, where string) string {
+	var sb strings.Builder
+	sb.WriteString("CREATE ")
+	if unique {
+		sb.WriteString("UNIQUE ")
+	}
+	sb.WriteString(fmt.Sprintf("INDEX %s ON %s (%s)", indexName, tableName, strings.Join(columns, ", ")))
+	if where != "" {
+		sb.WriteString(" WHERE " + where)
+	}
+	return sb.String()
+}
+
+// foreignKeySQL returns a FOREIGN KEY table constraint in the syntax shared by SQLite and PostgreSQL
+func foreignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate string) string {
+	sql := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", name, column, refTable, refColumn)
+	if onDelete != "" {
+		sql += " ON DELETE " + onDelete
+	}
+	if onUpdate != "" {
+		sql += " ON UPDATE " + onUpdate
+	}
+	return sql
+}
+
+// quoteString returns s as a single-quoted SQL string literal
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// jsonPathKeys splits a JSON path like $.a.b[0] into its keys a, b and 0
+func jsonPathKeys(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, strings.Trim(key, `"`))
+		}
+	}
+	return keys
+}
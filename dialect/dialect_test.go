@@ -0,0 +1,150 @@
+package dialect
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	sql := Rebind(d, "SELECT * FROM User WHERE Name = ? AND Note <> '?' AND Age > ?")
+	if sql != "SELECT * FROM User WHERE Name = $1 AND Note <> '?' AND Age > $2" {
+		t.Fatal("failed to rebind placeholders, got", sql)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	sqlite3, _ := GetDialect("sqlite3")
+	postgres, _ := GetDialect("postgres")
+	name := "O'Brien"
+	query := "SELECT * FROM User WHERE Name = ? AND Note <> '?' AND Active = ? AND Avatar = ? AND Age > ? AND Nick = ? AND Mail = ?"
+	vars := []any{&name, true, []byte{10, 255}, 18, (*string)(nil), (*sql.NullString)(nil)}
+	if sql := Interpolate(sqlite3, query, vars); sql != "SELECT * FROM User WHERE Name = 'O''Brien' AND Note <> '?' AND Active = 1 AND Avatar = X'0aff' AND Age > 18 AND Nick = NULL AND Mail = NULL" {
+		t.Fatal("failed to interpolate sqlite3 statement, got", sql)
+	}
+	if sql := Interpolate(postgres, query, vars); sql != "SELECT * FROM User WHERE Name = 'O''Brien' AND Note <> '?' AND Active = TRUE AND Avatar = '\\x0aff' AND Age > 18 AND Nick = NULL AND Mail = NULL" {
+		t.Fatal("failed to interpolate postgres statement, got", sql)
+	}
+}
+
+// minimal is a dialect providing only the methods of Dialect, as third party dialects may
+type minimal struct{}
+
+func (minimal) DataTypeOf(reflect.Value) string { return "text" }
+
+func (minimal) TableExistSQL(tableName string) (string, []any) {
+	return "SELECT name FROM tables WHERE name = ?", []any{tableName}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	RegisterDialect("minimal", minimal{})
+	d, _ := GetDialect("minimal")
+	if NameOf(d) != "minimal" || BindVar(d, 2) != "?" || LockingClause(d, "UPDATE", "") != "" {
+		t.Fatal("failed to fall back to the defaults of a dialect")
+	}
+	if sql := CreateIndexSQL(d, "User", "idx_name", []string{"Name"}, true, ""); sql != "CREATE UNIQUE INDEX idx_name ON User (Name)" {
+		t.Fatal("failed to fall back to the default index syntax, got", sql)
+	}
+	if sql := Interpolate(d, "SELECT ? WHERE ?", []any{"a'b", true}); sql != "SELECT 'a''b' WHERE 'true'" {
+		t.Fatal("failed to fall back to the default literals, got", sql)
+	}
+	if _, _, ok := IndexExistSQL(d, "User", "idx_name"); ok {
+		t.Fatal("expect a dialect without Indexer not to look up indexes")
+	}
+	if _, err := IntrospectorOf(d); err == nil {
+		t.Fatal("expect a dialect without Introspector not to introspect databases")
+	}
+}
+
+func TestPostgres_DataTypeOf(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	cases := []struct {
+		value any
+		typ   string
+	}{
+		{true, "boolean"}, {int8(1), "smallint"}, {1, "integer"}, {int64(1), "bigint"}, {uint64(1), "bigint"},
+		{float32(1), "real"}, {1.0, "double precision"}, {"", "text"}, {[]byte{}, "bytea"}, {time.Time{}, "timestamptz"},
+	}
+	for _, c := range cases {
+		if typ := d.DataTypeOf(reflect.ValueOf(c.value)); typ != c.typ {
+			t.Fatalf("failed to map %T, got %s", c.value, typ)
+		}
+	}
+	if typ := postgresType("numeric", sql.NullInt64{}, sql.NullInt64{Int64: 10, Valid: true}, sql.NullInt64{Int64: 2, Valid: true}); typ != "numeric(10,2)" {
+		t.Fatal("failed to convert numeric type, got", typ)
+	}
+	if typ := postgresType("timestamp with time zone", sql.NullInt64{}, sql.NullInt64{}, sql.NullInt64{}); typ != "timestamptz" {
+		t.Fatal("failed to convert timestamp type, got", typ)
+	}
+}
+
+func TestPostgres_SQL(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	if sql := Rebind(d, "UPDATE t SET a = ?, b = '?' WHERE c IN (?, ?)"); sql != "UPDATE t SET a = $1, b = '?' WHERE c IN ($2, $3)" {
+		t.Fatal("failed to rebind placeholders, got", sql)
+	}
+	if sql := JSONExtract(d, "Settings", "$.theme.name"); sql != "Settings#>>'{theme,name}'" {
+		t.Fatal("failed to extract a json path, got", sql)
+	}
+	if sql := LockingClause(d, "UPDATE", "SKIP LOCKED"); sql != "FOR UPDATE SKIP LOCKED" {
+		t.Fatal("failed to lock rows, got", sql)
+	}
+	if sql := DropColumnSQL(d, "User", "Age"); sql != "ALTER TABLE User DROP COLUMN Age" {
+		t.Fatal("failed to drop a column, got", sql)
+	}
+	statements := AlterColumnSQL(d, "User", ColumnInfo{Name: "Age", Type: "bigint", NotNull: true})
+	expected := []string{
+		"ALTER TABLE User ALTER COLUMN Age TYPE bigint USING Age::bigint",
+		"ALTER TABLE User ALTER COLUMN Age SET NOT NULL",
+		"ALTER TABLE User ALTER COLUMN Age DROP DEFAULT",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatal("failed to alter a column, got", statements)
+	}
+}
+
+// recordingQueryer records the introspection queries sent to it, and fails them
+type recordingQueryer struct {
+	queries []string
+	args    [][]any
+}
+
+var errRecorded = errors.New("recorded")
+
+func (q *recordingQueryer) Query(query string, args ...any) (*sql.Rows, error) {
+	q.queries = append(q.queries, query)
+	q.args = append(q.args, args)
+	return nil, errRecorded
+}
+
+func TestPostgres_Introspection(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	introspector, err := IntrospectorOf(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &recordingQueryer{}
+	_, _ = introspector.ColumnsOf(q, "User")
+	_, _ = introspector.IndexesOf(q, "User")
+	_, _ = introspector.ForeignKeysOf(q, "User")
+	if _, err := introspector.TablesOf(q); !errors.Is(err, errRecorded) {
+		t.Fatal("failed to return the error of the query, got", err)
+	}
+	catalogs := []string{"information_schema.columns", "pg_index", "pg_constraint", "information_schema.tables"}
+	if len(q.queries) != len(catalogs) {
+		t.Fatal("failed to query the catalogs, got", q.queries)
+	}
+	for i, catalog := range catalogs {
+		if !strings.Contains(q.queries[i], catalog) || !strings.Contains(q.queries[i], "current_schema()") {
+			t.Fatalf("failed to query %s of the current schema, got %s", catalog, q.queries[i])
+		}
+		// the table is bound to the placeholder of postgres
+		if i < 3 && (!strings.Contains(q.queries[i], "$1") || !reflect.DeepEqual(q.args[i], []any{"User"})) {
+			t.Fatalf("failed to bind the table, got %s %v", q.queries[i], q.args[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package dialect
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Queryer runs the queries introspecting a database, like *sql.DB and *sql.Tx
+type Queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Introspector is implemented by dialects describing the tables of a live database,
+// which migrations and generated models are built from
+type Introspector interface {
+	// ColumnsOf returns the columns of a live table in order, none if it doesn't exist
+	ColumnsOf(db Queryer, tableName string) ([]ColumnInfo, error)
+	IndexesOf(db Queryer, tableName string) ([]IndexInfo, error)
+	// ForeignKeysOf returns the foreign keys of a live table
+	ForeignKeysOf(db Queryer, tableName string) ([]ForeignKeyInfo, error)
+	// TablesOf returns the names of the tables of the database in order, views aside
+	TablesOf(db Queryer) ([]string, error)
+}
+
+// IntrospectorOf returns d as an Introspector, failing if it can't introspect databases
+func IntrospectorOf(d Dialect) (Introspector, error) {
+	if introspector, ok := d.(Introspector); ok {
+		return introspector, nil
+	}
+	return nil, fmt.Errorf("dialect %s can't introspect databases", NameOf(d))
+}
+
+// ColumnInfo describes a column of a live table
+type ColumnInfo struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+	// Unique is set if a UNIQUE constraint makes the column unique on its own
+	Unique bool
+	// Default is the default value as SQL, empty if there is none
+	Default string
+}
+
+// IndexInfo describes an index of a live table, indexes backing constraints are left out
+type IndexInfo struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	// Where is the condition of a partial index
+	Where string
+}
+
+// ForeignKeyInfo describes a foreign key of a live table
+type ForeignKeyInfo struct {
+	// Name is the name of the constraint, empty if the database doesn't keep it
+	Name string
+	// Columns refer to RefColumns of RefTable in order, they hold one column unless the key is composite
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	// OnDelete and OnUpdate are the referential actions, empty for NO ACTION
+	OnDelete string
+	OnUpdate string
+}
+
+// partialIndex matches the condition of CREATE INDEX ... WHERE
+var partialIndex = regexp.MustCompile(`(?is)\)\s*WHERE\s+(.+)$`)
+
+// indexWhere returns the condition of a CREATE INDEX statement, empty if the index isn't partial
+func indexWhere(createIndex string) string {
+	if match := partialIndex.FindStringSubmatch(createIndex); match != nil {
+		return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(match[1]), ";"))
+	}
+	return ""
+}
+
+// Rebuilder is implemented by dialects which change columns by rebuilding tables, see AlterColumnSQL
+type Rebuilder interface {
+	// ForeignKeysSQL returns the statement turning the enforcement of foreign keys on or off,
+	// it has no effect in a transaction
+	ForeignKeysSQL(enabled bool) string
+	// ForeignKeysEnabledSQL returns the query of whether foreign keys are enforced
+	ForeignKeysEnabledSQL() string
+	// ForeignKeyCheckSQL returns the query of the rows violating their foreign keys
+	ForeignKeyCheckSQL() string
+	// ForeignKeyCheck fails if rows of any table violate their foreign keys
+	ForeignKeyCheck(db Queryer) error
+	// DependentsOf returns the triggers and views depending on a table, which a rebuild drops or breaks
+	DependentsOf(db Queryer, tableName string) ([]Dependent, error)
+}
+
+// Dependent is a trigger or a view depending on a table
+type Dependent struct {
+	// Type is trigger or view
+	Type string
+	Name string
+	// SQL is the statement creating it
+	SQL string
+}
@@ -0,0 +1,285 @@
+package dialect
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type postgres struct{}
+
+var (
+	_ Dialect       = (*postgres)(nil)
+	_ Named         = (*postgres)(nil)
+	_ BindVarer     = (*postgres)(nil)
+	_ JSONExtractor = (*postgres)(nil)
+	_ Locker        = (*postgres)(nil)
+	_ Indexer       = (*postgres)(nil)
+	_ ForeignKeyer  = (*postgres)(nil)
+	_ Introspector  = (*postgres)(nil)
+	_ Alterer       = (*postgres)(nil)
+	_ Literaler     = (*postgres)(nil)
+)
+
+func init() {
+	RegisterDialect("postgres", &postgres{})
+	RegisterDialect("pgx", &postgres{})
+}
+
+func (p *postgres) Name() string {
+	return "postgres"
+}
+
+func (p *postgres) DataTypeOf(typ reflect.Value) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint"
+	case reflect.Int, reflect.Int32, reflect.Uint16, reflect.Uint32, reflect.Uintptr:
+		return "integer"
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return "bigint"
+	case reflect.Float32:
+		return "real"
+	case reflect.Float64:
+		return "double precision"
+	case reflect.String:
+		return "text"
+	case reflect.Array, reflect.Slice:
+		return "bytea"
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "timestamptz"
+		}
+	}
+	panic(fmt.Sprintf("invalid sql type %s (%s)", typ.Type().Name(), typ.Kind()))
+}
+
+func (p *postgres) TableExistSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT tablename FROM pg_tables WHERE schemaname = current_schema() and tablename = ?", args
+}
+
+func (p *postgres) BindVar(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+func (p *postgres) JSONExtract(column, path string) string {
+	keys := jsonPathKeys(path)
+	if len(keys) == 1 {
+		return fmt.Sprintf("%s->>%s", column, quoteString(keys[0]))
+	}
+	return fmt.Sprintf("%s#>>%s", column, quoteString("{"+strings.Join(keys, ",")+"}"))
+}
+
+func (p *postgres) LockingClause(strength, options string) string {
+	if options == "" {
+		return "FOR " + strength
+	}
+	return "FOR " + strength + " " + options
+}
+
+func (p *postgres) IndexExistSQL(tableName, indexName string) (string, []any) {
+	args := []any{tableName, indexName}
+	return "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() and tablename = ? and indexname = ?", args
+}
+
+func (p *postgres) CreateIndexSQL(tableName, indexName string, columns []string, unique bool, where string) string {
+	return createIndexSQL(tableName, indexName, columns, unique, where)
+}
+
+func (p *postgres) DropIndexSQL(_, indexName string) string {
+	return "DROP INDEX IF EXISTS " + indexName
+}
+
+func (p *postgres) ForeignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate string) string {
+	return foreignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate)
+}
+
+func (p *postgres) ColumnsOf(db Queryer, tableName string) ([]ColumnInfo, error) {
+	rows, err := db.Query(`SELECT c.column_name, c.data_type, c.character_maximum_length, c.numeric_precision, c.numeric_scale,
+  c.is_nullable = 'NO', c.column_default,
+  EXISTS (SELECT 1 FROM information_schema.table_constraints t
+    JOIN information_schema.key_column_usage k ON k.constraint_name = t.constraint_name
+      AND k.table_schema = t.table_schema AND k.table_name = t.table_name
+    WHERE t.constraint_type = 'PRIMARY KEY' AND t.table_schema = c.table_schema
+      AND t.table_name = c.table_name AND k.column_name = c.column_name),
+  EXISTS (SELECT 1 FROM information_schema.table_constraints t
+    JOIN information_schema.key_column_usage k ON k.constraint_name = t.constraint_name
+      AND k.table_schema = t.table_schema AND k.table_name = t.table_name
+    WHERE t.constraint_type = 'UNIQUE' AND t.table_schema = c.table_schema
+      AND t.table_name = c.table_name AND k.column_name = c.column_name
+      AND (SELECT count(*) FROM information_schema.key_column_usage u
+        WHERE u.constraint_name = t.constraint_name AND u.table_schema = t.table_schema) = 1)
+FROM information_schema.columns c
+WHERE c.table_schema = current_schema() AND c.table_name = $1 ORDER BY c.ordinal_position`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var columns []ColumnInfo
+	for rows.Next() {
+		var column ColumnInfo
+		var length, precision, scale sql.NullInt64
+		var defaultValue sql.NullString
+		if err := rows.Scan(&column.Name, &column.Type, &length, &precision, &scale,
+			&column.NotNull, &defaultValue, &column.PrimaryKey, &column.Unique); err != nil {
+			return nil, err
+		}
+		column.Type = postgresType(column.Type, length, precision, scale)
+		column.Default = defaultValue.String
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// postgresType converts a data type of information_schema to the name used in DDL
+func postgresType(dataType string, length, precision, scale sql.NullInt64) string {
+	switch dataType {
+	case "character varying":
+		if length.Valid {
+			return fmt.Sprintf("varchar(%d)", length.Int64)
+		}
+		return "varchar"
+	case "character":
+		return fmt.Sprintf("char(%d)", length.Int64)
+	case "numeric":
+		if precision.Valid {
+			return fmt.Sprintf("numeric(%d,%d)", precision.Int64, scale.Int64)
+		}
+	case "timestamp with time zone":
+		return "timestamptz"
+	case "timestamp without time zone":
+		return "timestamp"
+	}
+	return dataType
+}
+
+func (p *postgres) IndexesOf(db Queryer, tableName string) ([]IndexInfo, error) {
+	// indexes backing constraints, like the primary key, are left out
+	rows, err := db.Query(`SELECT ic.relname, ix.indisunique, a.attname, pg_get_expr(ix.indpred, ix.indrelid)
+FROM pg_index ix
+JOIN pg_class tc ON tc.oid = ix.indrelid
+JOIN pg_class ic ON ic.oid = ix.indexrelid
+JOIN pg_namespace n ON n.oid = tc.relnamespace
+JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+JOIN pg_attribute a ON a.attrelid = tc.oid AND a.attnum = k.attnum
+WHERE n.nspname = current_schema() AND tc.relname = $1
+  AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid)
+ORDER BY ic.relname, k.ord`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var indexes []IndexInfo
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		var where sql.NullString
+		if err := rows.Scan(&name, &unique, &column, &where); err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, IndexInfo{Name: name, Unique: unique, Where: where.String})
+		}
+		indexes[len(indexes)-1].Columns = append(indexes[len(indexes)-1].Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+func (p *postgres) ForeignKeysOf(db Queryer, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(`SELECT c.conname, a.attname, rt.relname, ra.attname, c.confdeltype, c.confupdtype
+FROM pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class rt ON rt.oid = c.confrelid
+JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord) ON true
+JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+WHERE c.contype = 'f' AND n.nspname = current_schema() AND t.relname = $1
+ORDER BY c.conname, k.ord`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var foreignKeys []ForeignKeyInfo
+	for rows.Next() {
+		var name, column, refTable, refColumn, onDelete, onUpdate string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn, &onDelete, &onUpdate); err != nil {
+			return nil, err
+		}
+		if len(foreignKeys) == 0 || foreignKeys[len(foreignKeys)-1].Name != name {
+			foreignKeys = append(foreignKeys, ForeignKeyInfo{
+				Name:     name,
+				RefTable: refTable,
+				OnDelete: postgresAction[onDelete],
+				OnUpdate: postgresAction[onUpdate],
+			})
+		}
+		fk := &foreignKeys[len(foreignKeys)-1]
+		fk.Columns = append(fk.Columns, column)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+	}
+	return foreignKeys, rows.Err()
+}
+
+// postgresAction maps the referential action codes of pg_constraint to SQL, NO ACTION is left empty
+var postgresAction = map[string]string{
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+func (p *postgres) TablesOf(db Queryer) ([]string, error) {
+	rows, err := db.Query(`SELECT table_name FROM information_schema.tables
+WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func (p *postgres) AlterColumnSQL(tableName string, column ColumnInfo) []string {
+	alter := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", tableName, column.Name)
+	statements := []string{alter + fmt.Sprintf("TYPE %s USING %s::%s", column.Type, column.Name, column.Type)}
+	if column.NotNull {
+		statements = append(statements, alter+"SET NOT NULL")
+	} else {
+		statements = append(statements, alter+"DROP NOT NULL")
+	}
+	if column.Default != "" {
+		statements = append(statements, alter+"SET DEFAULT "+column.Default)
+	} else {
+		statements = append(statements, alter+"DROP DEFAULT")
+	}
+	return statements
+}
+
+func (p *postgres) DropColumnSQL(tableName, columnName string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, columnName)
+}
+
+// Literal writes bools as TRUE and FALSE and bytes as bytea like '\x0aff'
+func (p *postgres) Literal(value any) string {
+	switch v := value.(type) {
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case []byte:
+		return fmt.Sprintf("'\\x%x'", v)
+	}
+	return literal(p, value)
+}
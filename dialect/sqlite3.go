@@ -1,19 +1,40 @@
 package dialect
 
 import (
+	"database/sql"
 	"fmt"
+	"github.com/go-needle/orm/log"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
 type sqlite3 struct{}
 
-var _ Dialect = (*sqlite3)(nil)
+var (
+	_ Dialect       = (*sqlite3)(nil)
+	_ Named         = (*sqlite3)(nil)
+	_ BindVarer     = (*sqlite3)(nil)
+	_ JSONExtractor = (*sqlite3)(nil)
+	_ Locker        = (*sqlite3)(nil)
+	_ Indexer       = (*sqlite3)(nil)
+	_ ForeignKeyer  = (*sqlite3)(nil)
+	_ Introspector  = (*sqlite3)(nil)
+	_ Alterer       = (*sqlite3)(nil)
+	_ Literaler     = (*sqlite3)(nil)
+	_ Rebuilder     = (*sqlite3)(nil)
+)
 
 func init() {
 	RegisterDialect("sqlite3", &sqlite3{})
 }
 
+func (s *sqlite3) Name() string {
+	return "sqlite3"
+}
+
 func (s *sqlite3) DataTypeOf(typ reflect.Value) string {
 	switch typ.Kind() {
 	case reflect.Bool:
@@ -41,3 +62,270 @@ func (s *sqlite3) TableExistSQL(tableName string) (string, []any) {
 	args := []any{tableName}
 	return "SELECT name FROM sqlite_master WHERE type='table' and name = ?", args
 }
+
+func (s *sqlite3) BindVar(int) string {
+	return "?"
+}
+
+func (s *sqlite3) JSONExtract(column, path string) string {
+	return fmt.Sprintf("json_extract(%s, %s)", column, quoteString(path))
+}
+
+var lockingWarning sync.Once
+
+// LockingClause is a no-op, SQLite locks the whole database instead of rows
+func (s *sqlite3) LockingClause(string, string) string {
+	lockingWarning.Do(func() {
+		log.Warn("sqlite3 doesn't support row locking, FOR UPDATE/SHARE is ignored. " +
+			"Writes are serialized by the database lock, use a transaction which writes first to take it early")
+	})
+	return ""
+}
+
+func (s *sqlite3) IndexExistSQL(tableName, indexName string) (string, []any) {
+	args := []any{tableName, indexName}
+	return "SELECT name FROM sqlite_master WHERE type='index' and tbl_name = ? and name = ?", args
+}
+
+func (s *sqlite3) CreateIndexSQL(tableName, indexName string, columns []string, unique bool, where string) string {
+	return createIndexSQL(tableName, indexName, columns, unique, where)
+}
+
+func (s *sqlite3) DropIndexSQL(_, indexName string) string {
+	return "DROP INDEX IF EXISTS " + indexName
+}
+
+// ForeignKeySQL declares a foreign key, SQLite enforces it once PRAGMA foreign_keys is ON
+func (s *sqlite3) ForeignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate string) string {
+	return foreignKeySQL(name, column, refTable, refColumn, onDelete, onUpdate)
+}
+
+func (s *sqlite3) ColumnsOf(db Queryer, tableName string) ([]ColumnInfo, error) {
+	// origin u is a UNIQUE constraint, its index holds a single column if the column is unique on its own
+	rows, err := db.Query(`SELECT c.name, c.type, c."notnull", c.dflt_value, c.pk,
+  EXISTS (SELECT 1 FROM pragma_index_list(?) l WHERE l.origin = 'u'
+    AND (SELECT count(*) FROM pragma_index_info(l.name)) = 1
+    AND (SELECT i.name FROM pragma_index_info(l.name) i) = c.name)
+FROM pragma_table_info(?) c ORDER BY c.cid`, tableName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var columns []ColumnInfo
+	for rows.Next() {
+		var column ColumnInfo
+		var defaultValue sql.NullString
+		var pk int
+		if err := rows.Scan(&column.Name, &column.Type, &column.NotNull, &defaultValue, &pk, &column.Unique); err != nil {
+			return nil, err
+		}
+		column.Default = defaultValue.String
+		column.PrimaryKey = pk > 0
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func (s *sqlite3) IndexesOf(db Queryer, tableName string) ([]IndexInfo, error) {
+	// origin c is CREATE INDEX, the others back PRIMARY KEY and UNIQUE constraints
+	rows, err := db.Query(`SELECT l.name, l."unique", m.sql FROM pragma_index_list(?) l
+JOIN sqlite_master m ON m.type = 'index' AND m.name = l.name WHERE l.origin = 'c' ORDER BY l.name`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []IndexInfo
+	for rows.Next() {
+		var index IndexInfo
+		var createIndex sql.NullString
+		if err := rows.Scan(&index.Name, &index.Unique, &createIndex); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		index.Where = indexWhere(createIndex.String)
+		indexes = append(indexes, index)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	// a single connection can't run a query while reading the rows of another one
+	for i := range indexes {
+		if indexes[i].Columns, err = s.indexColumns(db, indexes[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+func (s *sqlite3) ForeignKeysOf(db Queryer, tableName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.Query(`SELECT id, "table", "from", "to", on_update, on_delete
+FROM pragma_foreign_key_list(?) ORDER BY id, seq`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var foreignKeys []ForeignKeyInfo
+	var implicit []int
+	lastID := -1
+	for rows.Next() {
+		var id int
+		var refTable, column, onUpdate, onDelete string
+		var refColumn sql.NullString
+		if err := rows.Scan(&id, &refTable, &column, &refColumn, &onUpdate, &onDelete); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if id != lastID {
+			lastID = id
+			foreignKeys = append(foreignKeys, ForeignKeyInfo{
+				RefTable: refTable,
+				OnDelete: referentialAction(onDelete),
+				OnUpdate: referentialAction(onUpdate),
+			})
+			// REFERENCES without columns refers to the primary key
+			if !refColumn.Valid {
+				implicit = append(implicit, len(foreignKeys)-1)
+			}
+		}
+		fk := &foreignKeys[len(foreignKeys)-1]
+		fk.Columns = append(fk.Columns, column)
+		if refColumn.Valid {
+			fk.RefColumns = append(fk.RefColumns, refColumn.String)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	for _, i := range implicit {
+		columns, err := s.ColumnsOf(db, foreignKeys[i].RefTable)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			if column.PrimaryKey {
+				foreignKeys[i].RefColumns = append(foreignKeys[i].RefColumns, column.Name)
+			}
+		}
+	}
+	return foreignKeys, nil
+}
+
+// referentialAction returns action, empty for the default NO ACTION
+func referentialAction(action string) string {
+	if strings.EqualFold(action, "NO ACTION") {
+		return ""
+	}
+	return action
+}
+
+func (s *sqlite3) TablesOf(db Queryer) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func (s *sqlite3) indexColumns(db Queryer, indexName string) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM pragma_index_info(?) ORDER BY seqno", indexName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// AlterColumnSQL returns nil, SQLite can't alter columns
+func (s *sqlite3) AlterColumnSQL(string, ColumnInfo) []string {
+	return nil
+}
+
+// DropColumnSQL returns nothing, SQLite can't drop indexed, unique or key columns, the table is rebuilt
+func (s *sqlite3) DropColumnSQL(string, string) string {
+	return ""
+}
+
+func (s *sqlite3) ForeignKeysSQL(enabled bool) string {
+	if enabled {
+		return "PRAGMA foreign_keys = ON"
+	}
+	return "PRAGMA foreign_keys = OFF"
+}
+
+func (s *sqlite3) ForeignKeysEnabledSQL() string {
+	return "PRAGMA foreign_keys"
+}
+
+func (s *sqlite3) ForeignKeyCheckSQL() string {
+	return "PRAGMA foreign_key_check"
+}
+
+func (s *sqlite3) ForeignKeyCheck(db Queryer) error {
+	rows, err := db.Query(s.ForeignKeyCheckSQL())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fk int
+		if err := rows.Scan(&table, &rowID, &parent, &fk); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violation: row %d of %s refers to a missing row of %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
+
+func (s *sqlite3) DependentsOf(db Queryer, tableName string) ([]Dependent, error) {
+	rows, err := db.Query(`SELECT type, name, sql FROM sqlite_master
+WHERE type = 'trigger' AND tbl_name = ? OR type = 'view' ORDER BY type DESC, name`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	// views name the table in their SQL only, as a whole word, possibly quoted
+	name := regexp.MustCompile(`(?i)(^|[^\w$])` + regexp.QuoteMeta(tableName) + `([^\w$]|$)`)
+	var dependents []Dependent
+	for rows.Next() {
+		var dependent Dependent
+		if err := rows.Scan(&dependent.Type, &dependent.Name, &dependent.SQL); err != nil {
+			return nil, err
+		}
+		if dependent.Type == "view" && !name.MatchString(dependent.SQL) {
+			continue
+		}
+		dependents = append(dependents, dependent)
+	}
+	return dependents, rows.Err()
+}
+
+// Literal writes bools as 1 and 0 and bytes as blobs like X'0aff', as the driver stores them
+func (s *sqlite3) Literal(value any) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return fmt.Sprintf("X'%x'", v)
+	}
+	return literal(s, value)
+}
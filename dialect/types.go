@@ -0,0 +1,32 @@
+package dialect
+
+import (
+	"reflect"
+	"sync"
+)
+
+var (
+	typesMu  sync.RWMutex
+	typesMap = map[reflect.Type]map[string]string{}
+)
+
+// RegisterType declares the column type of typ for each dialect name,
+// e.g. RegisterType(reflect.TypeOf(UUID{}), map[string]string{"sqlite3": "text"}).
+// Types should be registered before the models using them are parsed.
+func RegisterType(typ reflect.Type, types map[string]string) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	m := make(map[string]string, len(types))
+	for name, dataType := range types {
+		m[name] = dataType
+	}
+	typesMap[typ] = m
+}
+
+// LookupType returns the column type registered for typ in the dialect named name
+func LookupType(typ reflect.Type, name string) (dataType string, ok bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	dataType, ok = typesMap[typ][name]
+	return
+}
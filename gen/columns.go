@@ -0,0 +1,123 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"github.com/go-needle/orm/schema"
+	"go/ast"
+	"go/format"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Columns returns the formatted Go source of package pkg declaring the columns of models, pointers
+// to structs of the package, as named by namer: a variable per model holding a clause.Column per
+// field, e.g. UserCols.Age for field Age of User, typed by the values of the field. The columns aren't
+// qualified, so that they work with Session.Table and aliases, see clause.Column.Of. Serialized fields
+// are left out, as they are compared to serialized values. It is the library behind orm-cols.
+func Columns(pkg string, namer schema.Namer, models ...any) ([]byte, error) {
+	// column names don't depend on the dialect, it only decides column types
+	d, _ := dialect.GetDialect("sqlite3")
+	w := &columnsWriter{imports: map[string]bool{"github.com/go-needle/orm/clause": true}}
+	var body bytes.Buffer
+	for _, model := range models {
+		modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+		if modelType.Kind() != reflect.Struct || modelType.Name() == "" {
+			return nil, fmt.Errorf("invalid model %T, it should be a pointer to a named struct", model)
+		}
+		if w.pkgPath == "" {
+			w.pkgPath = modelType.PkgPath()
+		} else if modelType.PkgPath() != w.pkgPath {
+			return nil, fmt.Errorf("model %s isn't in package %s", modelType, w.pkgPath)
+		}
+		w.write(&body, modelType.Name(), schema.ParseWithNamer(model, d, namer))
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by orm-cols. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", pkg)
+	paths := make([]string, 0, len(w.imports))
+	for path := range w.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		src.WriteString("\t" + strconv.Quote(path) + "\n")
+	}
+	src.WriteString(")\n\n")
+	src.Write(body.Bytes())
+	return format.Source(src.Bytes())
+}
+
+type columnsWriter struct {
+	// pkgPath is the package of the models, its types aren't qualified
+	pkgPath string
+	// imports are the paths of the packages used
+	imports map[string]bool
+}
+
+func (w *columnsWriter) write(body *bytes.Buffer, name string, table *schema.Schema) {
+	type column struct{ name, typ, mappingName string }
+	var columns []column
+	for _, field := range table.Fields {
+		if field.Serializer != nil {
+			continue
+		}
+		typ, ok := w.typeName(table.ValueType(field))
+		if !ok {
+			typ = "any"
+		}
+		columns = append(columns, column{
+			name:        strings.ReplaceAll(field.Name, ".", ""),
+			typ:         "clause.Column[" + typ + "]",
+			mappingName: field.MappingName,
+		})
+	}
+	fmt.Fprintf(body, "// %sCols are the columns of %s, in table %s\n", name, name, table.Name)
+	fmt.Fprintf(body, "var %sCols = struct {\n", name)
+	for _, c := range columns {
+		fmt.Fprintf(body, "\t%s %s\n", c.name, c.typ)
+	}
+	body.WriteString("}{\n")
+	for _, c := range columns {
+		fmt.Fprintf(body, "\t%s: %s{Name: %s},\n", c.name, c.typ, strconv.Quote(c.mappingName))
+	}
+	body.WriteString("}\n\n")
+}
+
+// typeName returns the name of typ in the generated package, false if it can't be named there
+func (w *columnsWriter) typeName(typ reflect.Type) (string, bool) {
+	if name := typ.Name(); name != "" {
+		switch {
+		case strings.Contains(name, "["):
+			// an instance of a generic type
+			return "", false
+		case typ.PkgPath() == "" || typ.PkgPath() == w.pkgPath:
+			return name, true
+		case !ast.IsExported(name):
+			return "", false
+		}
+		pkg, _, _ := strings.Cut(typ.String(), ".")
+		w.imports[typ.PkgPath()] = true
+		return pkg + "." + name, true
+	}
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		elem, ok := w.typeName(typ.Elem())
+		switch typ.Kind() {
+		case reflect.Pointer:
+			return "*" + elem, ok
+		case reflect.Slice:
+			return "[]" + elem, ok
+		}
+		return fmt.Sprintf("[%d]%s", typ.Len(), elem), ok
+	case reflect.Map:
+		key, keyOK := w.typeName(typ.Key())
+		elem, elemOK := w.typeName(typ.Elem())
+		return "map[" + key + "]" + elem, keyOK && elemOK
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package gen
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/schema"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Address struct {
+	City string
+}
+
+type Customer struct {
+	ID        int `orm:"pk"`
+	FullName  string
+	Nickname  *string
+	Email     sql.NullString
+	CreatedAt time.Time
+	Home      Address  `orm:"embedded;prefix:home_"`
+	Tags      []string `orm:"serializer:json"`
+}
+
+func TestColumns(t *testing.T) {
+	src, err := Columns("models", schema.SnakeNamer{}, &Customer{})
+	if err != nil {
+		t.Fatal("failed to generate", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "cols.go", src, 0); err != nil {
+		t.Fatal("generated invalid source", err)
+	}
+	for _, line := range []string{
+		"\"github.com/go-needle/orm/clause\"\n\t\"time\"",
+		"var CustomerCols = struct {",
+		"FullName  clause.Column[string]",
+		"Nickname  clause.Column[string]",
+		"CreatedAt clause.Column[time.Time]",
+		"HomeCity  clause.Column[string]",
+		"FullName:  clause.Column[string]{Name: \"full_name\"}",
+		"HomeCity:  clause.Column[string]{Name: \"home_city\"}",
+	} {
+		if !strings.Contains(string(src), line) {
+			t.Fatalf("failed to generate %s, got\n%s", line, src)
+		}
+	}
+	if strings.Contains(string(src), "Tags") {
+		t.Fatal("serialized fields should be left out")
+	}
+	if _, err := Columns("models", nil, &Customer{}, &sql.NullString{}); err == nil {
+		t.Fatal("models of different packages should fail")
+	}
+}
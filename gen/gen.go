@@ -0,0 +1,384 @@
+// Package gen writes Go source for models: the structs of the tables of an existing database,
+// see Generate and orm-gen, and the typed columns of model structs, see Columns and orm-cols.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"go/format"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Config selects what Generate writes
+type Config struct {
+	// Package is the package of the generated file, models by default
+	Package string
+	// Tables are the tables to generate, all the tables of the database if empty
+	Tables []string
+}
+
+// Generate returns the formatted Go source of a struct per table of db, introspected by d. Fields have
+// orm tags naming their column and declaring primary keys, NOT NULL, defaults and indexes, nullable
+// columns are pointers. Column types which d doesn't derive from the Go type are kept by a type tag.
+// Each single column foreign key between generated tables adds a belongs to field to the table holding
+// it, and a has many field to the table it refers to, or has one if the key is unique by itself,
+// by a UNIQUE constraint or a unique index.
+func Generate(db dialect.Queryer, d dialect.Dialect, config Config) ([]byte, error) {
+	introspector, err := dialect.IntrospectorOf(d)
+	if err != nil {
+		return nil, err
+	}
+	names := config.Tables
+	if len(names) == 0 {
+		if names, err = introspector.TablesOf(db); err != nil {
+			return nil, err
+		}
+	}
+	g := &generator{dialect: d, introspector: introspector, tables: make(map[string]*table)}
+	for _, name := range names {
+		if err := g.load(db, name); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range g.order {
+		g.associate(t)
+	}
+
+	pkg := config.Package
+	if pkg == "" {
+		pkg = "models"
+	}
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	if g.usesTime {
+		src.WriteString("import \"time\"\n\n")
+	}
+	for _, t := range g.order {
+		t.write(&src)
+	}
+	return format.Source(src.Bytes())
+}
+
+type generator struct {
+	dialect      dialect.Dialect
+	introspector dialect.Introspector
+	tables       map[string]*table
+	order        []*table
+	structs      map[string]bool
+	usesTime     bool
+}
+
+// table is a struct being generated
+type table struct {
+	name        string
+	structName  string
+	columns     []dialect.ColumnInfo
+	foreignKeys []dialect.ForeignKeyInfo
+	fields      []*field
+	// columnFields maps column names to their fields
+	columnFields map[string]*field
+	// uniqueColumns are the columns unique on their own, by a primary key, a UNIQUE constraint or a unique index
+	uniqueColumns map[string]bool
+	goNames       map[string]bool
+}
+
+type field struct {
+	name    string
+	goType  string
+	tag     []string
+	comment string
+	// keys are the index tag keys set, a field takes one of each
+	keys map[string]bool
+}
+
+func (g *generator) load(db dialect.Queryer, name string) error {
+	columns, err := g.introspector.ColumnsOf(db, name)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s not found", name)
+	}
+	indexes, err := g.introspector.IndexesOf(db, name)
+	if err != nil {
+		return err
+	}
+	foreignKeys, err := g.introspector.ForeignKeysOf(db, name)
+	if err != nil {
+		return err
+	}
+	if g.structs == nil {
+		g.structs = make(map[string]bool)
+	}
+	t := &table{
+		name:          name,
+		structName:    uniqueName(goName(name), g.structs),
+		columns:       columns,
+		foreignKeys:   foreignKeys,
+		columnFields:  make(map[string]*field),
+		uniqueColumns: make(map[string]bool),
+		goNames:       make(map[string]bool),
+	}
+	g.structs[t.structName] = true
+
+	primaryKeys := 0
+	for _, column := range columns {
+		if column.PrimaryKey {
+			primaryKeys++
+		}
+	}
+	for _, column := range columns {
+		f := &field{name: uniqueName(goName(column.Name), t.goNames), keys: make(map[string]bool)}
+		t.goNames[f.name] = true
+		f.tag = append(f.tag, "name:"+column.Name)
+		var dataType string
+		f.goType, dataType = g.goType(column.Type)
+		if column.PrimaryKey {
+			f.tag = append(f.tag, "pk")
+			if primaryKeys == 1 {
+				t.uniqueColumns[column.Name] = true
+			}
+		} else if column.NotNull {
+			f.tag = append(f.tag, "notNull")
+		} else if f.goType != "[]byte" {
+			f.goType = "*" + f.goType
+		}
+		if dataType != "" {
+			f.tag = append(f.tag, "type:"+dataType)
+		}
+		if column.Default != "" {
+			f.tag = append(f.tag, "default:"+column.Default)
+		}
+		if column.Unique {
+			f.tag = append(f.tag, "constraint:UNIQUE")
+			t.uniqueColumns[column.Name] = true
+		}
+		t.fields = append(t.fields, f)
+		t.columnFields[column.Name] = f
+	}
+	for _, index := range indexes {
+		key := "index"
+		if index.Unique {
+			key = "uniqueIndex"
+			if len(index.Columns) == 1 {
+				t.uniqueColumns[index.Columns[0]] = true
+			}
+		}
+		for i, column := range index.Columns {
+			f := t.columnFields[column]
+			if f == nil {
+				continue
+			}
+			if f.keys[key] {
+				f.comment += fmt.Sprintf(" %s %s is left out, a field has one %s tag.", key, index.Name, key)
+				continue
+			}
+			f.keys[key] = true
+			value := index.Name
+			if len(index.Columns) > 1 {
+				value += ",priority:" + strconv.Itoa(i+1)
+			}
+			if index.Where != "" {
+				value += ",where:" + index.Where
+			}
+			f.tag = append(f.tag, key+":"+value)
+		}
+	}
+	g.tables[name] = t
+	g.order = append(g.order, t)
+	return nil
+}
+
+// goTypes are the Go types tried in order for a column type, the first one d maps to it wins
+var goTypes = []reflect.Type{
+	reflect.TypeOf(0),
+	reflect.TypeOf(int64(0)),
+	reflect.TypeOf(int16(0)),
+	reflect.TypeOf(float64(0)),
+	reflect.TypeOf(float32(0)),
+	reflect.TypeOf(""),
+	reflect.TypeOf(false),
+	reflect.TypeOf(time.Time{}),
+	reflect.TypeOf([]byte(nil)),
+}
+
+// goType returns the Go type of columns of type dataType, and the type tag keeping dataType,
+// empty if the dialect maps the Go type back to it
+func (g *generator) goType(dataType string) (string, string) {
+	for _, typ := range goTypes {
+		if strings.EqualFold(g.dialect.DataTypeOf(reflect.New(typ).Elem()), dataType) {
+			return g.typeName(typ), ""
+		}
+	}
+	return g.typeName(affinity(strings.ToLower(dataType))), dataType
+}
+
+func (g *generator) typeName(typ reflect.Type) string {
+	switch typ {
+	case reflect.TypeOf(time.Time{}):
+		g.usesTime = true
+	case reflect.TypeOf([]byte(nil)):
+		return "[]byte"
+	}
+	return typ.String()
+}
+
+// affinity returns the Go type of a column type unknown to the dialect, by the rules
+// SQLite uses to decide the affinity of a column from its declared type
+func affinity(dataType string) reflect.Type {
+	switch {
+	case strings.Contains(dataType, "bool"):
+		return reflect.TypeOf(false)
+	case strings.Contains(dataType, "int"):
+		return reflect.TypeOf(int64(0))
+	case strings.Contains(dataType, "char"), strings.Contains(dataType, "clob"), strings.Contains(dataType, "text"):
+		return reflect.TypeOf("")
+	case strings.Contains(dataType, "date"), strings.Contains(dataType, "time"):
+		return reflect.TypeOf(time.Time{})
+	case dataType == "", strings.Contains(dataType, "blob"), strings.Contains(dataType, "bytea"):
+		return reflect.TypeOf([]byte(nil))
+	case strings.Contains(dataType, "real"), strings.Contains(dataType, "floa"), strings.Contains(dataType, "doub"),
+		strings.Contains(dataType, "numeric"), strings.Contains(dataType, "decimal"):
+		return reflect.TypeOf(float64(0))
+	}
+	return reflect.TypeOf("")
+}
+
+// associate adds the association fields of the foreign keys of t
+func (g *generator) associate(t *table) {
+	for _, fk := range t.foreignKeys {
+		ref, ok := g.tables[fk.RefTable]
+		if !ok || len(fk.Columns) != 1 || len(fk.RefColumns) != 1 {
+			continue
+		}
+		foreignKey, references := t.columnFields[fk.Columns[0]], ref.columnFields[fk.RefColumns[0]]
+		if foreignKey == nil || references == nil {
+			continue
+		}
+
+		// belongs to, named after the column without its id suffix, e.g. Author for author_id
+		name := ref.structName
+		if trimmed := trimID(fk.Columns[0]); trimmed != "" && !t.goNames[goName(trimmed)] {
+			name = goName(trimmed)
+		}
+		belongsTo := &field{name: uniqueName(name, t.goNames), goType: "*" + ref.structName}
+		t.goNames[belongsTo.name] = true
+		belongsTo.tag = append(belongsTo.tag, "foreignKey:"+foreignKey.name)
+		if !isPrimaryKey(ref, fk.RefColumns[0]) {
+			belongsTo.tag = append(belongsTo.tag, "references:"+references.name)
+		}
+		if fk.OnDelete != "" {
+			belongsTo.tag = append(belongsTo.tag, "onDelete:"+fk.OnDelete)
+		}
+		if fk.OnUpdate != "" {
+			belongsTo.tag = append(belongsTo.tag, "onUpdate:"+fk.OnUpdate)
+		}
+		t.fields = append(t.fields, belongsTo)
+
+		// has one or has many, named after t, e.g. Posts, or PostsAuthor if the name is taken
+		name = t.structName
+		if ref.goNames[name] {
+			name += belongsTo.name
+		}
+		owned := &field{name: uniqueName(name, ref.goNames), goType: "[]" + t.structName}
+		if t.uniqueColumns[fk.Columns[0]] {
+			owned.goType = "*" + t.structName
+		}
+		ref.goNames[owned.name] = true
+		owned.tag = append(owned.tag, "foreignKey:"+foreignKey.name)
+		if !isPrimaryKey(ref, fk.RefColumns[0]) {
+			owned.tag = append(owned.tag, "references:"+references.name)
+		}
+		ref.fields = append(ref.fields, owned)
+	}
+}
+
+// isPrimaryKey reports whether column is the primary key of t on its own
+func isPrimaryKey(t *table, column string) bool {
+	for _, c := range t.columns {
+		if c.PrimaryKey && c.Name != column {
+			return false
+		}
+	}
+	for _, c := range t.columns {
+		if c.Name == column {
+			return c.PrimaryKey
+		}
+	}
+	return false
+}
+
+func (t *table) write(src *bytes.Buffer) {
+	fmt.Fprintf(src, "// %s is a row of table %s\n", t.structName, t.name)
+	fmt.Fprintf(src, "type %s struct {\n", t.structName)
+	for _, f := range t.fields {
+		fmt.Fprintf(src, "\t%s %s %s", f.name, f.goType, structTag("orm:"+strconv.Quote(strings.Join(f.tag, ";"))))
+		if f.comment != "" {
+			src.WriteString(" //" + f.comment)
+		}
+		src.WriteString("\n")
+	}
+	src.WriteString("}\n\n")
+	fmt.Fprintf(src, "func (%s) TableName() string {\n\treturn %s\n}\n\n", t.structName, strconv.Quote(t.name))
+}
+
+// structTag returns the literal of tag, a raw string unless it holds a backquote
+func structTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// initialisms are the words of names written in capitals, as Go does
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true, "JSON": true,
+	"SQL": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// goName returns the exported Go name of a table or column name, e.g. UserID for user_id
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var sb strings.Builder
+	for _, word := range words {
+		if upper := strings.ToUpper(word); initialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	goName := sb.String()
+	if goName == "" || !unicode.IsLetter([]rune(goName)[0]) {
+		goName = "X" + goName
+	}
+	return goName
+}
+
+// trimID returns a column name without its id suffix, e.g. author for author_id or authorId
+func trimID(column string) string {
+	if len(column) > 2 && strings.EqualFold(column[len(column)-2:], "id") {
+		return strings.TrimRight(column[:len(column)-2], "_")
+	}
+	return ""
+}
+
+// uniqueName returns name, or name followed by the first number making it unique in taken
+func uniqueName(name string, taken map[string]bool) string {
+	if !taken[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		if candidate := name + strconv.Itoa(i); !taken[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/dialect"
+	_ "github.com/mattn/go-sqlite3"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	db, err := sql.Open("sqlite3", "g.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	for _, sql := range []string{
+		"DROP TABLE IF EXISTS blog_posts;",
+		"DROP TABLE IF EXISTS blog_profiles;",
+		"DROP TABLE IF EXISTS blog_authors;",
+		"CREATE TABLE blog_authors (id integer PRIMARY KEY, name text NOT NULL, email varchar(255), joined_at datetime);",
+		"CREATE UNIQUE INDEX uidx_blog_authors_email ON blog_authors (email);",
+		`CREATE TABLE blog_posts (id integer PRIMARY KEY, author_id integer NOT NULL REFERENCES blog_authors ON DELETE CASCADE,
+  title text DEFAULT 'untitled', rating real, body blob);`,
+		"CREATE INDEX idx_blog_posts_author ON blog_posts (author_id, title) WHERE rating > 1;",
+		"CREATE TABLE blog_profiles (id integer PRIMARY KEY, author_id integer UNIQUE REFERENCES blog_authors, bio text);",
+	} {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, _ := dialect.GetDialect("sqlite3")
+	src, err := Generate(db, d, Config{Tables: []string{"blog_authors", "blog_posts", "blog_profiles"}})
+	if err != nil {
+		t.Fatal("failed to generate", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "models.go", src, 0); err != nil {
+		t.Fatal("generated invalid source", err)
+	}
+	for _, line := range []string{
+		"func (BlogAuthors) TableName() string",
+		"Email        *string       `orm:\"name:email;type:varchar(255);uniqueIndex:uidx_blog_authors_email\"`",
+		"JoinedAt     *time.Time    `orm:\"name:joined_at\"`",
+		"BlogPosts    []BlogPosts   `orm:\"foreignKey:AuthorID\"`",
+		"BlogProfiles *BlogProfiles `orm:\"foreignKey:AuthorID\"`",
+		"AuthorID *int         `orm:\"name:author_id;constraint:UNIQUE\"`",
+		"AuthorID int          `orm:\"name:author_id;notNull;index:idx_blog_posts_author,priority:1,where:rating > 1\"`",
+		"Title    *string      `orm:\"name:title;default:'untitled';index:idx_blog_posts_author,priority:2,where:rating > 1\"`",
+		"Body     []byte       `orm:\"name:body\"`",
+		"Author   *BlogAuthors `orm:\"foreignKey:AuthorID;onDelete:CASCADE\"`",
+	} {
+		if !strings.Contains(string(src), line) {
+			t.Fatalf("failed to generate %s, got\n%s", line, src)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"user_id":   "UserID",
+		"userName":  "UserName",
+		"api-key":   "APIKey",
+		"2fa_codes": "X2faCodes",
+	} {
+		if got := goName(name); got != expected {
+			t.Errorf("goName(%q) = %s, expected %s", name, got, expected)
+		}
+	}
+}
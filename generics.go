@@ -0,0 +1,129 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-needle/orm/clause"
+	"github.com/go-needle/orm/session"
+	"reflect"
+)
+
+// Query is a statement on the records of model T, a struct type, checked at compile time instead of
+// by reflection. It is built on a copy-on-write session: every method returns a new query and leaves
+// the receiver untouched, so a base query can be reused. Hooks of T are called as by the session.
+type Query[T any] struct {
+	session *session.Session
+	// ordered is set by OrderBy, First orders by primary key otherwise
+	ordered bool
+}
+
+// G returns a query of the records of T, e.g. G[User](engine).Where("Age > ?", 18).Find(ctx)
+func G[T any](engine *Engine) *Query[T] {
+	return GWith[T](engine.NewSession())
+}
+
+// GWith returns a query of the records of T on s, e.g. the session of a transaction
+func GWith[T any](s *session.Session) *Query[T] {
+	var model T
+	if typ := reflect.TypeOf(model); typ == nil || typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("invalid model %T, it should be a struct", model))
+	}
+	return &Query[T]{session: s.Model(&model).Session()}
+}
+
+// Session returns the session the query is built on
+func (q *Query[T]) Session() *session.Session {
+	return q.session
+}
+
+func (q *Query[T]) with(s *session.Session) *Query[T] {
+	return &Query[T]{session: s, ordered: q.ordered}
+}
+
+// Where adds a condition, see session.Session.Where
+func (q *Query[T]) Where(desc any, args ...any) *Query[T] {
+	return q.with(q.session.Where(desc, args...))
+}
+
+func (q *Query[T]) OrderBy(desc string) *Query[T] {
+	c := q.with(q.session.OrderBy(desc))
+	c.ordered = true
+	return c
+}
+
+func (q *Query[T]) Limit(num int) *Query[T] {
+	return q.with(q.session.Limit(num))
+}
+
+// Preload loads the associations on path with the records, see session.Session.Preload
+func (q *Query[T]) Preload(path string) *Query[T] {
+	return q.with(q.session.Preload(path))
+}
+
+// Joins loads the association name with the records in the same query, see session.Session.Joins
+func (q *Query[T]) Joins(name string) *Query[T] {
+	return q.with(q.session.Joins(name))
+}
+
+// Unscoped includes soft deleted records, and makes Delete remove records for good
+func (q *Query[T]) Unscoped() *Query[T] {
+	return q.with(q.session.Unscoped())
+}
+
+// Clauses adds clauses taking their own slot in the statement, like clause.Locking
+func (q *Query[T]) Clauses(clauses ...clause.Interface) *Query[T] {
+	return q.with(q.session.Clauses(clauses...))
+}
+
+// Find returns the records matching the query
+func (q *Query[T]) Find(ctx context.Context) ([]T, error) {
+	var records []T
+	if err := q.session.WithContext(ctx).Find(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// First returns the first record matching the query, by primary key unless ordered,
+// session.ErrNotFound if there is none
+func (q *Query[T]) First(ctx context.Context) (T, error) {
+	s := q.session
+	if table := s.RefTable(); !q.ordered && table.PrimaryField != nil {
+		s = s.OrderBy(table.Name + "." + table.PrimaryField.MappingName)
+	}
+	return q.with(s).Take(ctx)
+}
+
+// Take returns a record matching the query, in no particular order unless ordered,
+// session.ErrNotFound if there is none
+func (q *Query[T]) Take(ctx context.Context) (T, error) {
+	var record T
+	err := q.session.WithContext(ctx).First(&record)
+	return record, err
+}
+
+// Count returns the number of records matching the query
+func (q *Query[T]) Count(ctx context.Context) (int64, error) {
+	return q.session.WithContext(ctx).Count()
+}
+
+// Update sets columns of the records matching the query, given as a map[string]any or
+// a list of names and values, and returns the number of records updated
+func (q *Query[T]) Update(ctx context.Context, kv ...any) (int64, error) {
+	return q.session.WithContext(ctx).Update(kv...)
+}
+
+// Delete deletes the records matching the query, soft deleting them if T has a soft delete field,
+// and returns the number of records deleted
+func (q *Query[T]) Delete(ctx context.Context) (int64, error) {
+	return q.session.WithContext(ctx).Delete()
+}
+
+// Each calls f with the records matching the query one by one as they are read, without holding
+// them in memory at once. It stops at the first error of f and returns it.
+func (q *Query[T]) Each(ctx context.Context, f func(T) error) error {
+	var record T
+	return q.session.WithContext(ctx).Each(&record, func() error {
+		return f(record)
+	})
+}
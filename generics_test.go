@@ -0,0 +1,62 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/go-needle/orm/session"
+	"testing"
+)
+
+func TestG(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&User{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&User{"Tom", 18}, &User{"Sam", 25}, &User{"Ann", 30})
+	ctx := context.Background()
+
+	adults := G[User](engine).Where("Age > ?", 20)
+	users, err := adults.OrderBy("Age DESC").Find(ctx)
+	if err != nil || len(users) != 2 || users[0].Name != "Ann" {
+		t.Fatal("failed to find records", users, err)
+	}
+	if count, err := adults.Count(ctx); err != nil || count != 2 {
+		t.Fatal("failed to count records, base query changed", count, err)
+	}
+	if user, err := G[User](engine).First(ctx); err != nil || user.Name != "Ann" {
+		t.Fatal("failed to find the first record by primary key", user, err)
+	}
+	if user, err := G[User](engine).Where("Name = ?", "Tom").Take(ctx); err != nil || user.Age != 18 {
+		t.Fatal("failed to take a record", user, err)
+	}
+	if _, err := G[User](engine).Where("Age > ?", 99).First(ctx); !errors.Is(err, session.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+
+	var names []string
+	err = G[User](engine).OrderBy("Age").Each(ctx, func(user User) error {
+		names = append(names, user.Name)
+		return nil
+	})
+	if err != nil || len(names) != 3 || names[0] != "Tom" {
+		t.Fatal("failed to iterate records", names, err)
+	}
+	stop := errors.New("stop")
+	if err := G[User](engine).Each(ctx, func(User) error { return stop }); err != stop {
+		t.Fatal("expected the error of f, got", err)
+	}
+
+	if affected, err := adults.Update(ctx, "Age", 40); err != nil || affected != 2 {
+		t.Fatal("failed to update records", affected, err)
+	}
+	if affected, err := G[User](engine).Where("Age = ?", 40).Delete(ctx); err != nil || affected != 2 {
+		t.Fatal("failed to delete records", affected, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := G[User](engine).Find(canceled); err == nil {
+		t.Fatal("a canceled context should fail the query")
+	}
+}
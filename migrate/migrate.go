@@ -0,0 +1,260 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-needle/orm"
+	"github.com/go-needle/orm/log"
+	"github.com/go-needle/orm/session"
+	"sort"
+	"time"
+)
+
+// DefaultTableName is the name of the history table of applied migrations
+const DefaultTableName = "schema_migrations"
+
+// ErrChecksumMismatch is returned when an applied SQL migration was modified afterwards
+var ErrChecksumMismatch = errors.New("checksum mismatch: the migration changed after it was applied")
+
+// Migration is a versioned schema change, migrations are applied in the order of their IDs,
+// e.g. 20240101120000_create_users. It runs either Go funcs or SQL scripts, which are
+// executed as they are, so they can hold several statements where the driver supports it.
+type Migration struct {
+	ID      string
+	Up      func(s *session.Session) error
+	Down    func(s *session.Session) error
+	UpSQL   string
+	DownSQL string
+}
+
+// Checksum returns the checksum of the SQL scripts, it is empty for Go migrations
+func (m *Migration) Checksum() string {
+	if m.UpSQL == "" && m.DownSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL + "\x00" + m.DownSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) up(s *session.Session) error {
+	if m.Up != nil {
+		return m.Up(s)
+	}
+	return execScript(s, m.UpSQL)
+}
+
+func (m *Migration) down(s *session.Session) error {
+	if m.Down != nil {
+		return m.Down(s)
+	}
+	if m.DownSQL == "" {
+		return fmt.Errorf("migration %s can't be reverted, it has no down script", m.ID)
+	}
+	return execScript(s, m.DownSQL)
+}
+
+func execScript(s *session.Session, script string) error {
+	if script == "" {
+		return nil
+	}
+	_, err := s.DB().Exec(script)
+	return err
+}
+
+// history is a row of the history table
+type history struct {
+	ID        string    `orm:"name:id;pk"`
+	Checksum  string    `orm:"name:checksum"`
+	AppliedAt time.Time `orm:"name:applied_at"`
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when an applied migration doesn't match its checksum anymore
+	Modified bool
+	// Missing is set when an applied migration isn't known by the Migrator
+	Missing bool
+}
+
+// Migrator applies and reverts migrations, one transaction per migration
+type Migrator struct {
+	// TableName is the history table, DefaultTableName by default
+	TableName string
+	// Debug logs the SQL of the history table and of Go migrations
+	Debug bool
+
+	engine     *orm.Engine
+	migrations []*Migration
+}
+
+func New(engine *orm.Engine, migrations ...*Migration) *Migrator {
+	return &Migrator{TableName: DefaultTableName, engine: engine, migrations: migrations}
+}
+
+// Add adds migrations to the Migrator
+func (m *Migrator) Add(migrations ...*Migration) {
+	m.migrations = append(m.migrations, migrations...)
+}
+
+func (m *Migrator) session() *session.Session {
+	s := m.engine.NewSession().Model(&history{}).Table(m.TableName)
+	if m.Debug {
+		s = s.Debug()
+	}
+	return s
+}
+
+// sorted returns the migrations ordered by ID, failing on duplicates
+func (m *Migrator) sorted() ([]*Migration, error) {
+	migrations := append([]*Migration(nil), m.migrations...)
+	sort.SliceStable(migrations, func(i, j int) bool { return migrations[i].ID < migrations[j].ID })
+	for i, migration := range migrations {
+		if migration.ID == "" {
+			return nil, errors.New("migration without ID")
+		}
+		if i > 0 && migrations[i-1].ID == migration.ID {
+			return nil, fmt.Errorf("duplicate migration %s", migration.ID)
+		}
+	}
+	return migrations, nil
+}
+
+// applied returns the history rows ordered by ID, creating the history table if it doesn't exist
+func (m *Migrator) applied() ([]history, error) {
+	s := m.session()
+	if !s.HasTable() {
+		if err := s.CreateTable(); err != nil {
+			return nil, err
+		}
+	}
+	var rows []history
+	if err := s.OrderBy("id").Find(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// verify fails when an applied migration was modified
+func verify(migration *Migration, row history) error {
+	if migration.Checksum() != row.Checksum {
+		return fmt.Errorf("migration %s: %w", migration.ID, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order, it stops at the first failure,
+// whose changes are rolled back with its transaction
+func (m *Migrator) Up() error {
+	migrations, err := m.sorted()
+	if err != nil {
+		return err
+	}
+	rows, err := m.applied()
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]history, len(rows))
+	for _, row := range rows {
+		applied[row.ID] = row
+	}
+	for _, migration := range migrations {
+		if row, ok := applied[migration.ID]; ok {
+			if err := verify(migration, row); err != nil {
+				return err
+			}
+		}
+	}
+	for _, migration := range migrations {
+		if _, ok := applied[migration.ID]; ok {
+			continue
+		}
+		log.Infof("migrate up %s", migration.ID)
+		_, err := m.engine.Transaction(func(s *session.Session) (any, error) {
+			if err := migration.up(s); err != nil {
+				return nil, err
+			}
+			row := &history{ID: migration.ID, Checksum: migration.Checksum(), AppliedAt: time.Now()}
+			return s.Model(row).Table(m.TableName).Insert(row)
+		}, m.Debug)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the last n applied migrations, most recent first
+func (m *Migrator) Down(n int) error {
+	migrations, err := m.sorted()
+	if err != nil {
+		return err
+	}
+	rows, err := m.applied()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]*Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.ID] = migration
+	}
+	for i := len(rows) - 1; i >= 0 && i >= len(rows)-n; i-- {
+		row := rows[i]
+		migration, ok := known[row.ID]
+		if !ok {
+			return fmt.Errorf("migration %s is applied but unknown", row.ID)
+		}
+		if err := verify(migration, row); err != nil {
+			return err
+		}
+		log.Infof("migrate down %s", migration.ID)
+		_, err := m.engine.Transaction(func(s *session.Session) (any, error) {
+			if err := migration.down(s); err != nil {
+				return nil, err
+			}
+			return s.Model(&history{}).Table(m.TableName).Where("id = ?", migration.ID).Delete()
+		}, m.Debug)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// Status returns the state of the known migrations in order, followed by
+// the applied migrations the Migrator doesn't know
+func (m *Migrator) Status() ([]Status, error) {
+	migrations, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]history, len(rows))
+	for _, row := range rows {
+		applied[row.ID] = row
+	}
+	var statuses []Status
+	for _, migration := range migrations {
+		status := Status{ID: migration.ID}
+		if row, ok := applied[migration.ID]; ok {
+			status.Applied = true
+			status.AppliedAt = row.AppliedAt
+			status.Modified = verify(migration, row) != nil
+			delete(applied, migration.ID)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range rows {
+		if _, ok := applied[row.ID]; ok {
+			statuses = append(statuses, Status{ID: row.ID, Applied: true, AppliedAt: row.AppliedAt, Missing: true})
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"errors"
+	"github.com/go-needle/orm"
+	"github.com/go-needle/orm/session"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"testing/fstest"
+)
+
+func OpenDB(t *testing.T) *orm.Engine {
+	t.Helper()
+	engine, err := orm.NewEngine("sqlite3", "g.db")
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	s := engine.NewSession()
+	for _, table := range []string{DefaultTableName, "Book", "Shelf"} {
+		_, _ = s.Raw("DROP TABLE IF EXISTS " + table).Exec()
+	}
+	return engine
+}
+
+var files = fstest.MapFS{
+	"migrations/001_create_book.sql": {Data: []byte(`-- create the first table
+-- +up
+CREATE TABLE Book (Title text PRIMARY KEY);
+INSERT INTO Book (Title) VALUES ('Go');
+-- +down
+DROP TABLE Book;
+`)},
+	"migrations/002_create_shelf.sql": {Data: []byte("-- +up\nCREATE TABLE Shelf (Name text);\n-- +down\nDROP TABLE Shelf;\n")},
+	"migrations/README.md":            {Data: []byte("not a migration")},
+}
+
+func hasTable(engine *orm.Engine, name string) bool {
+	var tmp string
+	_ = engine.NewSession().Raw("SELECT name FROM sqlite_master WHERE type='table' and name = ?", name).QueryRow().Scan(&tmp)
+	return tmp == name
+}
+
+func TestMigrator(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	migrations, err := LoadFS(files, "migrations")
+	if err != nil || len(migrations) != 2 {
+		t.Fatal("failed to load migrations", err)
+	}
+	addAuthor := &Migration{
+		ID: "003_add_author",
+		Up: func(s *session.Session) error {
+			_, err := s.Raw("ALTER TABLE Book ADD COLUMN Author text").Exec()
+			return err
+		},
+	}
+	m := New(engine, migrations...)
+	m.Add(addAuthor)
+	if err := m.Up(); err != nil {
+		t.Fatal("failed to migrate up", err)
+	}
+	if !hasTable(engine, "Book") || !hasTable(engine, "Shelf") {
+		t.Fatal("failed to apply migrations")
+	}
+	// applied migrations are skipped
+	if err := m.Up(); err != nil {
+		t.Fatal("failed to migrate up again", err)
+	}
+	statuses, _ := m.Status()
+	if len(statuses) != 3 || !statuses[0].Applied || !statuses[2].Applied || statuses[0].AppliedAt.IsZero() {
+		t.Fatal("failed to get status, got", statuses)
+	}
+
+	if err := m.Down(1); err == nil {
+		t.Fatal("expect an error for a migration without down")
+	}
+	if err := New(engine, migrations...).Down(2); err == nil {
+		t.Fatal("expect an error for an unknown applied migration")
+	}
+	addAuthor.Down = func(s *session.Session) error { return nil }
+	if err := m.Down(2); err != nil || !hasTable(engine, "Book") || hasTable(engine, "Shelf") {
+		t.Fatal("failed to migrate down", err)
+	}
+	statuses, _ = m.Status()
+	if !statuses[0].Applied || statuses[1].Applied || statuses[2].Applied {
+		t.Fatal("failed to record migrate down, got", statuses)
+	}
+
+	migrations[0].UpSQL += "\nINSERT INTO Book (Title) VALUES ('SQL');"
+	if err := m.Up(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatal("expect a checksum mismatch, got", err)
+	}
+	if statuses, _ = m.Status(); !statuses[0].Modified {
+		t.Fatal("failed to report a modified migration")
+	}
+}
+
+func TestMigrator_Rollback(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	failing := &Migration{ID: "001_failing", UpSQL: "CREATE TABLE Shelf (Name text); INSERT INTO Missing VALUES (1);"}
+	m := New(engine, failing)
+	if err := m.Up(); err == nil {
+		t.Fatal("expect an error for a failing migration")
+	}
+	if hasTable(engine, "Shelf") {
+		t.Fatal("failed to roll back a failing migration")
+	}
+	if statuses, _ := m.Status(); statuses[0].Applied {
+		t.Fatal("a failing migration shouldn't be recorded")
+	}
+}
+
+func TestParseSQL(t *testing.T) {
+	if _, err := ParseSQL("001", "CREATE TABLE Book (Title text);"); err == nil {
+		t.Fatal("expect an error for a statement before -- +up")
+	}
+	migration, err := ParseSQL("001", "--  +UP\nSELECT 1;\n-- +Down\nSELECT 2;")
+	if err != nil || migration.UpSQL != "SELECT 1;" || migration.DownSQL != "SELECT 2;" {
+		t.Fatal("failed to parse SQL migration", migration, err)
+	}
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ParseSQL returns the migration id of an SQL script, whose up and down statements
+// follow the -- +up and -- +down lines, e.g.
+//
+//	-- +up
+//	CREATE TABLE users (id integer PRIMARY KEY);
+//	-- +down
+//	DROP TABLE users;
+func ParseSQL(id, script string) (*Migration, error) {
+	var up, down strings.Builder
+	var section *strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch strings.ToLower(strings.Join(strings.Fields(line), " ")) {
+		case "-- +up":
+			section = &up
+			continue
+		case "-- +down":
+			section = &down
+			continue
+		}
+		if section == nil {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, fmt.Errorf("migration %s: statement before -- +up", id)
+			}
+			continue
+		}
+		section.WriteString(line)
+		section.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(up.String()) == "" {
+		return nil, fmt.Errorf("migration %s: no -- +up statements", id)
+	}
+	return &Migration{ID: id, UpSQL: strings.TrimSpace(up.String()), DownSQL: strings.TrimSpace(down.String())}, nil
+}
+
+// LoadFS returns the migrations of the .sql files in dir of fsys, e.g. an embed.FS,
+// named by their ID like 20240101120000_create_users.sql
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []*Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, err := ParseSQL(strings.TrimSuffix(entry.Name(), ".sql"), string(content))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
@@ -1,17 +1,21 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/go-needle/orm/dialect"
 	"github.com/go-needle/orm/log"
+	"github.com/go-needle/orm/schema"
 	"github.com/go-needle/orm/session"
-	"strings"
+	"time"
 )
 
 type Engine struct {
 	db      *sql.DB
 	dialect dialect.Dialect
+	namer   schema.Namer
+	nowFunc func() time.Time
 }
 
 func NewEngine(driver, source string) (e *Engine, err error) {
@@ -43,8 +47,18 @@ func (engine *Engine) Close() {
 	log.Info("Close database success")
 }
 
+// SetNamer sets the naming strategy of tables and columns for new sessions
+func (engine *Engine) SetNamer(namer schema.Namer) {
+	engine.namer = namer
+}
+
+// SetNowFunc sets the clock of auto time fields for new sessions
+func (engine *Engine) SetNowFunc(nowFunc func() time.Time) {
+	engine.nowFunc = nowFunc
+}
+
 func (engine *Engine) NewSession() *session.Session {
-	return session.New(engine.db, engine.dialect)
+	return session.New(engine.db, engine.dialect).WithNamer(engine.namer).WithNowFunc(engine.nowFunc)
 }
 
 type TxFunc func(*session.Session) (any, error)
@@ -57,6 +71,11 @@ func (engine *Engine) Transaction(f TxFunc, isDebug bool) (result any, err error
 	if err := s.Begin(); err != nil {
 		return nil, err
 	}
+	return runTransaction(s, f)
+}
+
+// runTransaction runs f in the transaction begun by s, and commits it if f succeeds
+func runTransaction(s *session.Session, f TxFunc) (result any, err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			_ = s.Rollback()
@@ -71,51 +90,226 @@ func (engine *Engine) Transaction(f TxFunc, isDebug bool) (result any, err error
 	return f(s)
 }
 
-// difference returns a - b
-func difference(a []string, b []string) (diff []string) {
-	setB := make(map[string]struct{})
-	for _, v := range b {
-		setB[v] = struct{}{}
+// migrationTransaction runs f in a transaction like Transaction. On dialects rebuilding tables,
+// foreign keys are turned off for the connection of the transaction, as dropping a table would
+// delete the rows referring to it, and they are checked before committing if they were on.
+func (engine *Engine) migrationTransaction(f TxFunc, isDebug bool) (result any, err error) {
+	rebuilder, ok := engine.dialect.(dialect.Rebuilder)
+	if !ok {
+		return engine.Transaction(f, isDebug)
+	}
+	ctx := context.Background()
+	conn, err := engine.db.Conn(ctx)
+	if err != nil {
+		return nil, err
 	}
-	for _, v := range a {
-		if _, ok := setB[v]; !ok {
-			diff = append(diff, v)
+	defer func() { _ = conn.Close() }()
+	// the setting can't change in a transaction, so it's set on the connection beforehand
+	var enabled bool
+	if err = conn.QueryRowContext(ctx, rebuilder.ForeignKeysEnabledSQL()).Scan(&enabled); err != nil {
+		return nil, err
+	}
+	if enabled {
+		if _, err = conn.ExecContext(ctx, rebuilder.ForeignKeysSQL(false)); err != nil {
+			return nil, err
 		}
+		defer func() {
+			if _, restoreErr := conn.ExecContext(ctx, rebuilder.ForeignKeysSQL(true)); err == nil {
+				err = restoreErr
+			}
+		}()
 	}
-	return
+	log.Info("transaction begin")
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := engine.NewSession().WithTx(tx)
+	if isDebug {
+		s = s.Debug()
+	}
+	return runTransaction(s, func(s *session.Session) (any, error) {
+		result, err := f(s)
+		if err == nil && enabled {
+			err = rebuilder.ForeignKeyCheck(tx)
+		}
+		return result, err
+	})
 }
 
-// Migrate table
+// Migrate table, the changes between the model and its table in the database are logged before they are applied
 func (engine *Engine) Migrate(value any, isDebug bool) error {
-	_, err := engine.Transaction(func(s *session.Session) (result any, err error) {
-		if !s.Model(value).HasTable() {
-			log.Infof("table %s doesn't exist", s.RefTable().Name)
-			return nil, s.CreateTable()
-		}
-		table := s.RefTable()
-		rows, _ := s.Raw(fmt.Sprintf("SELECT * FROM %s LIMIT 1", table.Name)).QueryRows()
-		columns, _ := rows.Columns()
-		addCols := difference(table.MappingFieldNames, columns)
-		delCols := difference(columns, table.MappingFieldNames)
-		log.Infof("added cols %v, deleted cols %v", addCols, delCols)
-		for _, col := range addCols {
-			f := table.GetField(col)
-			sqlStr := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table.Name, f.MappingName, f.Type)
-			if _, err = s.Raw(sqlStr).Exec(); err != nil {
-				return
-			}
+	_, err := engine.migrationTransaction(func(s *session.Session) (result any, err error) {
+		plan, err := s.Model(value).Plan()
+		if err != nil {
+			return
 		}
-
-		if len(delCols) == 0 {
+		if plan.Empty() {
+			log.Infof("table %s is up to date", plan.Table)
+			return nil, s.CreateJoinTables()
+		}
+		log.Infof("migrate table %s:\n%s", plan.Table, plan)
+		if err = s.Apply(plan); err != nil {
 			return
 		}
-		tmp := "tmp_" + table.Name
-		fieldStr := strings.Join(table.MappingFieldNames, ", ")
-		s.Raw(fmt.Sprintf("CREATE TABLE %s AS SELECT %s FROM %s;", tmp, fieldStr, table.Name))
-		s.Raw(fmt.Sprintf("DROP TABLE %s;", table.Name))
-		s.Raw(fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tmp, table.Name))
-		_, err = s.Exec()
-		return
+		return nil, s.CreateJoinTables()
 	}, isDebug)
 	return err
 }
+
+// MigratePlan returns the statements Migrate would execute to migrate the tables of models,
+// in order and terminated by semicolons, e.g. to be reviewed as an SQL file. Nothing is executed.
+// Rebuilds of SQLite tables turn foreign keys off before and check them after, as the setting has
+// no effect in a transaction the file shouldn't be run in one.
+func (engine *Engine) MigratePlan(models ...any) ([]string, error) {
+	s := engine.NewSession().DryRun()
+	for _, value := range models {
+		plan, err := s.Model(value).Plan()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Apply(plan); err != nil {
+			return nil, err
+		}
+		if err := s.CreateJoinTables(); err != nil {
+			return nil, err
+		}
+	}
+	var statements []string
+	seen := make(map[string]bool)
+	for _, statement := range s.Statements() {
+		// models sharing a join table both create it
+		if sql := statement.String(); !seen[sql] {
+			seen[sql] = true
+			statements = append(statements, sql)
+		}
+	}
+	return statements, nil
+}
+
+// AutoMigrate migrates the tables of models and the join tables of their many to many relationships,
+// e.g. AutoMigrate(&User{}, &Order{}, &Item{}). Tables are migrated after the tables they refer to,
+// whatever the order of models, and join tables last, all in one transaction. The plans applied are
+// returned in that order, one per table, empty if it was up to date, none if the migration failed.
+func (engine *Engine) AutoMigrate(models ...any) ([]*schema.Plan, error) {
+	s := engine.NewSession()
+	var tables []*schema.Schema
+	seen := make(map[string]bool)
+	for _, value := range models {
+		if table := s.Model(value).RefTable(); !seen[table.Name] {
+			seen[table.Name] = true
+			tables = append(tables, table)
+		}
+	}
+	tables, err := dependencyOrder(tables)
+	if err != nil {
+		return nil, err
+	}
+	var plans []*schema.Plan
+	migrate := func(s *session.Session, plan *schema.Plan) error {
+		plans = append(plans, plan)
+		if plan.Empty() {
+			log.Infof("table %s is up to date", plan.Table)
+			return nil
+		}
+		log.Infof("migrate table %s:\n%s", plan.Table, plan)
+		return s.Apply(plan)
+	}
+	_, err = engine.migrationTransaction(func(s *session.Session) (any, error) {
+		for _, table := range tables {
+			plan, err := s.Model(table.Model).Plan()
+			if err != nil {
+				return nil, err
+			}
+			if err := migrate(s, plan); err != nil {
+				return nil, err
+			}
+		}
+		seen := make(map[string]bool)
+		for _, table := range tables {
+			joinPlans, err := s.Model(table.Model).JoinTablePlans()
+			if err != nil {
+				return nil, err
+			}
+			// both models of a relationship share its join table
+			for _, plan := range joinPlans {
+				if seen[plan.Table] {
+					continue
+				}
+				seen[plan.Table] = true
+				if err := migrate(s, plan); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}, false)
+	if err != nil {
+		// the plans were rolled back
+		return nil, err
+	}
+	return plans, nil
+}
+
+// dependencyOrder sorts tables so that each one comes after the tables it refers to by a foreign key:
+// the tables its belongs to relationships refer to, and the owners of its has one or has many ones.
+// Tables keep their order otherwise, tables referring to each other are an error.
+func dependencyOrder(tables []*schema.Schema) ([]*schema.Schema, error) {
+	dependencies := make(map[string]map[string]bool)
+	for _, table := range tables {
+		dependencies[table.Name] = make(map[string]bool)
+	}
+	// tables outside the migration are left as they are, they can't be waited for
+	depend := func(table, on string) {
+		if _, ok := dependencies[on]; !ok {
+			return
+		}
+		if _, ok := dependencies[table]; ok && table != on {
+			dependencies[table][on] = true
+		}
+	}
+	for _, table := range tables {
+		for _, fk := range table.ForeignKeys() {
+			depend(table.Name, fk.References.Name)
+		}
+		for _, rel := range table.Relationships {
+			if rel.Type == schema.HasOne || rel.Type == schema.HasMany {
+				depend(rel.Schema().Name, table.Name)
+			}
+		}
+	}
+
+	ordered := make([]*schema.Schema, 0, len(tables))
+	done := make(map[string]bool)
+	for len(ordered) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if done[table.Name] || !dependenciesDone(dependencies[table.Name], done) {
+				continue
+			}
+			done[table.Name] = true
+			ordered = append(ordered, table)
+			progress = true
+			break
+		}
+		if !progress {
+			var cycle []string
+			for _, table := range tables {
+				if !done[table.Name] {
+					cycle = append(cycle, table.Name)
+				}
+			}
+			return nil, fmt.Errorf("can't order the migration of tables %v, they refer to each other", cycle)
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesDone(dependencies, done map[string]bool) bool {
+	for name := range dependencies {
+		if !done[name] {
+			return false
+		}
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/go-needle/orm/session"
 	_ "github.com/mattn/go-sqlite3"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -63,6 +64,34 @@ func transactionCommit(t *testing.T) {
 	}
 }
 
+func TestEngine_TransactionCallbacks(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	var events []string
+	_, _ = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		s.AfterCommit(func() { events = append(events, "commit1") })
+		s.AfterCommit(func() { events = append(events, "commit2") })
+		s.AfterRollback(func() { events = append(events, "rollback") })
+		if len(events) != 0 {
+			t.Fatal("callbacks ran before commit")
+		}
+		return
+	}, false)
+	if !reflect.DeepEqual(events, []string{"commit1", "commit2"}) {
+		t.Fatal("failed to run after commit callbacks, got", events)
+	}
+
+	events = nil
+	_, _ = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		s.AfterCommit(func() { events = append(events, "commit") })
+		s.AfterRollback(func() { events = append(events, "rollback") })
+		return nil, errors.New("Error")
+	}, false)
+	if !reflect.DeepEqual(events, []string{"rollback"}) {
+		t.Fatal("failed to run after rollback callbacks, got", events)
+	}
+}
+
 func TestEngine_Migrate(t *testing.T) {
 	engine := OpenDB(t)
 	defer engine.Close()
@@ -72,7 +101,7 @@ func TestEngine_Migrate(t *testing.T) {
 	_, _ = s.Raw("INSERT INTO User(`Name`) values (?), (?);", "Tom", "Sam").Exec()
 	err := engine.Migrate(&User{}, true)
 	if err != nil {
-		return
+		t.Fatal("failed to migrate", err)
 	}
 
 	rows, _ := s.Raw("SELECT * FROM User WHERE User.Name=?", "Tom").QueryRows()
@@ -81,3 +110,215 @@ func TestEngine_Migrate(t *testing.T) {
 		t.Fatal("Failed to migrate table User, got columns", columns)
 	}
 }
+
+func TestEngine_MigratePlan(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS User;").Exec()
+	_, _ = s.Raw("CREATE TABLE User(Name text PRIMARY KEY, XXX integer);").Exec()
+	statements, err := engine.MigratePlan(&User{})
+	if err != nil {
+		t.Fatal("failed to plan migration", err)
+	}
+	expected := []string{
+		"PRAGMA foreign_keys = OFF;",
+		"CREATE TABLE new_User (Name text PRIMARY KEY,Age integer);",
+		"INSERT INTO new_User (Name) SELECT Name FROM User;",
+		"DROP TABLE User;",
+		"ALTER TABLE new_User RENAME TO User;",
+		"PRAGMA foreign_key_check;",
+		"PRAGMA foreign_keys = ON;",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatal("failed to plan migration, got", statements)
+	}
+	if plan, _ := s.Model(&User{}).Plan(); plan.Empty() {
+		t.Fatal("a migration plan shouldn't be applied")
+	}
+}
+
+type Writer struct {
+	ID       int    `orm:"pk"`
+	FullName string `orm:"renamedFrom:Name;index"`
+}
+
+type Novel struct {
+	ID       int `orm:"pk"`
+	WriterID int
+	Writer   *Writer `orm:"onDelete:CASCADE"`
+}
+
+func TestEngine_MigrateRebuild(t *testing.T) {
+	engine, err := NewEngine("sqlite3", "g.db?_foreign_keys=1")
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.NewSession()
+	_ = s.Model(&Novel{}).DropTable()
+	_, _ = s.Raw("DROP VIEW IF EXISTS WriterNames;").Exec()
+	_, _ = s.Raw("DROP VIEW IF EXISTS WriterLogNames;").Exec()
+	_ = s.Model(&Writer{}).DropTable()
+	_, _ = s.Raw("CREATE TABLE Writer (ID integer PRIMARY KEY, Name text, Age integer);").Exec()
+	_, _ = s.Raw("DROP TABLE IF EXISTS WriterLog;").Exec()
+	_, _ = s.Raw("CREATE TABLE WriterLog (Name text);").Exec()
+	_, _ = s.Raw("CREATE TRIGGER WriterInsert AFTER INSERT ON Writer BEGIN INSERT INTO WriterLog VALUES ('x'); END;").Exec()
+	_, _ = s.Raw("CREATE VIEW WriterNames AS SELECT ID FROM Writer;").Exec()
+	// a view on a table whose name starts with Writer doesn't depend on Writer
+	_, _ = s.Raw("CREATE VIEW WriterLogNames AS SELECT Name FROM WriterLog;").Exec()
+	_, _ = s.Raw("INSERT INTO Writer (ID, Name, Age) VALUES (1, 'Tom', 18);").Exec()
+	_ = s.Model(&Novel{}).CreateTable()
+	if _, err := s.Insert(&Novel{ID: 1, WriterID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.Migrate(&Writer{}, true); err != nil {
+		t.Fatal("failed to migrate", err)
+	}
+	writer := &Writer{}
+	if err := s.First(writer); err != nil || writer.FullName != "Tom" {
+		t.Fatal("failed to keep renamed column, got", writer, err)
+	}
+	if count, _ := s.Model(&Novel{}).Count(); count != 1 {
+		t.Fatal("rows referring to the rebuilt table were deleted")
+	}
+	if !s.Model(&Writer{}).HasIndex("idx_Writer_FullName") {
+		t.Fatal("failed to create index after rebuild")
+	}
+	var ids, logs int
+	_ = s.Raw("SELECT count(*) FROM WriterNames").QueryRow().Scan(&ids)
+	_, _ = s.Insert(&Writer{ID: 2, FullName: "Sam"})
+	_ = s.Raw("SELECT count(*) FROM WriterLog").QueryRow().Scan(&logs)
+	if ids != 1 || logs != 2 {
+		t.Fatal("failed to recreate view and trigger", ids, logs)
+	}
+	var enabled bool
+	_ = s.Raw("PRAGMA foreign_keys").QueryRow().Scan(&enabled)
+	if !enabled {
+		t.Fatal("failed to restore foreign keys")
+	}
+
+	// a rename alone doesn't need a rebuild
+	_, _ = s.Raw("ALTER TABLE Writer RENAME COLUMN FullName TO Name;").Exec()
+	statements, err := engine.MigratePlan(&Writer{})
+	if err != nil || len(statements) != 3 || statements[0] != "ALTER TABLE Writer RENAME COLUMN Name TO FullName;" {
+		t.Fatal("failed to plan a rename, got", statements, err)
+	}
+
+	// a rebuild planned on a connection enforcing foreign keys turns them off itself
+	_, _ = s.Raw("ALTER TABLE Writer RENAME COLUMN Name TO FullName;").Exec()
+	_, _ = s.Raw("ALTER TABLE Writer ADD COLUMN Age integer;").Exec()
+	statements, err = engine.MigratePlan(&Writer{})
+	if err != nil || len(statements) < 3 || statements[0] != "PRAGMA foreign_keys = OFF;" ||
+		statements[len(statements)-2] != "PRAGMA foreign_key_check;" || statements[len(statements)-1] != "PRAGMA foreign_keys = ON;" {
+		t.Fatal("failed to plan a rebuild with foreign keys enforced, got", statements, err)
+	}
+	for _, statement := range statements {
+		if strings.Contains(statement, "WriterLogNames") {
+			t.Fatal("failed to leave views of other tables, got", statements)
+		}
+	}
+	if !strings.Contains(strings.Join(statements, "\n"), "DROP VIEW WriterNames;") {
+		t.Fatal("failed to recreate the view of the table, got", statements)
+	}
+}
+
+type Shelf struct {
+	ID    int `orm:"pk"`
+	Books []Book
+}
+
+type Book struct {
+	ID      int `orm:"pk"`
+	ShelfID int
+	Shelf   *Shelf
+	Labels  []*Label `orm:"many2many:book_labels"`
+}
+
+type Label struct {
+	ID   int `orm:"pk"`
+	Name string
+}
+
+func TestEngine_AutoMigrate(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS book_labels;").Exec()
+	_ = s.Model(&Book{}).DropTable()
+	_ = s.Model(&Shelf{}).DropTable()
+	_ = s.Model(&Label{}).DropTable()
+	_, _ = s.Raw("CREATE TABLE Label (ID integer PRIMARY KEY);").Exec()
+
+	plans, err := engine.AutoMigrate(&Book{}, &Label{}, &Shelf{})
+	if err != nil {
+		t.Fatal("failed to migrate", err)
+	}
+	var summary []string
+	for _, plan := range plans {
+		summary = append(summary, strings.TrimSpace(plan.String()))
+	}
+	expected := []string{
+		"Label: add column Name text",
+		"Shelf: create table",
+		"Book: create table",
+		"book_labels: create table",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("failed to migrate in order, got %q", summary)
+	}
+
+	plans, err = engine.AutoMigrate(&Shelf{}, &Book{}, &Label{})
+	if err != nil || len(plans) != 4 {
+		t.Fatal("failed to migrate again", plans, err)
+	}
+	for _, plan := range plans {
+		if !plan.Empty() {
+			t.Fatal("tables should be up to date, got", plan)
+		}
+	}
+}
+
+func TestEngine_AutoMigrateSubset(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS book_labels;").Exec()
+	_ = s.Model(&Book{}).DropTable()
+	_ = s.Model(&Shelf{}).DropTable()
+
+	// Book refers to Shelf, which isn't migrated
+	plans, err := engine.AutoMigrate(&Book{})
+	if err != nil {
+		t.Fatal("failed to migrate a table referring to a table outside the migration", err)
+	}
+	if len(plans) == 0 || plans[0].Table != "Book" || s.Model(&Shelf{}).HasTable() {
+		t.Fatal("failed to migrate Book only, got", plans)
+	}
+}
+
+type Badge struct {
+	ID   int    `orm:"pk"`
+	Code string `orm:"notNull"`
+}
+
+func TestEngine_AutoMigrateRollback(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS book_labels;").Exec()
+	_ = s.Model(&Book{}).DropTable()
+	_ = s.Model(&Shelf{}).DropTable()
+	_ = s.Model(&Badge{}).DropTable()
+	_, _ = s.Raw("CREATE TABLE Badge (ID integer PRIMARY KEY);").Exec()
+
+	// Code can't be added without a default, the creation of Shelf is rolled back
+	plans, err := engine.AutoMigrate(&Shelf{}, &Badge{})
+	if err == nil || plans != nil {
+		t.Fatal("expect a failed migration to return no plans, got", plans, err)
+	}
+	if s.Model(&Shelf{}).HasTable() {
+		t.Fatal("failed to roll back the migration")
+	}
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TimeUnit is the precision of an auto time field, the zero value disables it
+type TimeUnit int
+
+const (
+	_ TimeUnit = iota
+	// UnixTime stores the time itself, for time.Time like fields
+	UnixTime
+	UnixSecond
+	UnixMilli
+	UnixNano
+)
+
+// Value returns now in the precision of unit
+func (unit TimeUnit) Value(now time.Time) any {
+	switch unit {
+	case UnixSecond:
+		return now.Unix()
+	case UnixMilli:
+		return now.UnixMilli()
+	case UnixNano:
+		return now.UnixNano()
+	}
+	return now
+}
+
+// parseTimeUnit returns the unit of an auto time field of type typ,
+// tag is the value of the autoCreateTime or autoUpdateTime tag
+func parseTimeUnit(typ reflect.Type, tag string) TimeUnit {
+	switch strings.ToLower(tag) {
+	case "false":
+		return 0
+	case "milli":
+		return UnixMilli
+	case "nano":
+		return UnixNano
+	case "second":
+		return UnixSecond
+	}
+	// time.Time, *time.Time and sql.NullTime
+	if valueType, _ := indirectNullable(typ); valueType.Kind() == reflect.Struct {
+		return UnixTime
+	}
+	return UnixSecond
+}
+
+// autoTime returns the unit of field p if it is an auto time field: tagged with
+// key, or named name by convention and not disabled by the tag
+func autoTime(p reflect.StructField, settings map[string]string, key, name string) TimeUnit {
+	if tag, ok := settings[strings.ToLower(key)]; ok {
+		return parseTimeUnit(p.Type, tag)
+	}
+	if p.Name == name {
+		return parseTimeUnit(p.Type, "")
+	}
+	return 0
+}
+
+// Set assigns value to the field of dest, converting it to the type of the field.
+// Nil pointers on the way are allocated and sql.Scanner fields scan the value.
+func (field *Field) Set(dest reflect.Value, value any) error {
+	return setValue(field.Settable(dest), value)
+}
+
+func setValue(v reflect.Value, value any) error {
+	if value == nil {
+		v.SetZero()
+		return nil
+	}
+	if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.Type().ConvertibleTo(v.Type()) {
+		return fmt.Errorf("can't assign %T to %s", value, v.Type())
+	}
+	v.Set(rv.Convert(v.Type()))
+	return nil
+}
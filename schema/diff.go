@@ -0,0 +1,240 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"strings"
+)
+
+// FromTable returns the schema of a live table introspected by the dialect, it has no model
+func FromTable(name string, columns []dialect.ColumnInfo, indexes []dialect.IndexInfo) *Schema {
+	schema := &Schema{Name: name, fieldMap: make(map[string]*Field)}
+	for _, column := range columns {
+		field := &Field{
+			Name:        column.Name,
+			MappingName: column.Name,
+			Type:        column.Type,
+			NotNull:     column.NotNull,
+			PrimaryKey:  column.PrimaryKey,
+			Default:     column.Default,
+		}
+		schema.Fields = append(schema.Fields, field)
+		schema.MappingFieldNames = append(schema.MappingFieldNames, field.MappingName)
+		schema.fieldMap[field.Name] = field
+		if field.PrimaryKey && schema.PrimaryField == nil {
+			schema.PrimaryField = field
+		}
+	}
+	for _, info := range indexes {
+		index := &Index{Name: info.Name, Unique: info.Unique, Where: info.Where}
+		for i, column := range info.Columns {
+			if field := schema.lookupColumn(column); field != nil {
+				index.Fields = append(index.Fields, IndexField{Field: field, Priority: i})
+			}
+		}
+		schema.Indexes = append(schema.Indexes, index)
+	}
+	return schema
+}
+
+// lookupColumn returns the field of column name, which is case-insensitive in SQL
+func (schema *Schema) lookupColumn(name string) *Field {
+	for _, field := range schema.Fields {
+		if strings.EqualFold(field.MappingName, name) {
+			return field
+		}
+	}
+	return nil
+}
+
+// ChangeKind is the kind of a change of a Plan
+type ChangeKind string
+
+const (
+	CreateTable ChangeKind = "create table"
+	AddColumn   ChangeKind = "add column"
+	DropColumn  ChangeKind = "drop column"
+	AlterColumn ChangeKind = "alter column"
+	// RenameColumn renames a column to a field tagged renamedFrom
+	RenameColumn ChangeKind = "rename column"
+	AddIndex     ChangeKind = "add index"
+	DropIndex    ChangeKind = "drop index"
+)
+
+// Change is a change turning a live table into the table of a model
+type Change struct {
+	Kind ChangeKind
+	// Field is the column in the model for AddColumn, AlterColumn and RenameColumn
+	Field *Field
+	// Live is the column in the database for DropColumn, AlterColumn and RenameColumn
+	Live *Field
+	// Index is the index in the model for AddIndex, in the database for DropIndex
+	Index *Index
+	// Details tell what differs for AlterColumn, e.g. type: integer -> text
+	Details []string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case AddColumn:
+		return fmt.Sprintf("%s %s %s", c.Kind, c.Field.MappingName, c.Field.Type)
+	case DropColumn:
+		return fmt.Sprintf("%s %s", c.Kind, c.Live.MappingName)
+	case AlterColumn:
+		return fmt.Sprintf("%s %s (%s)", c.Kind, c.Field.MappingName, strings.Join(c.Details, ", "))
+	case RenameColumn:
+		return fmt.Sprintf("%s %s to %s", c.Kind, c.Live.MappingName, c.Field.MappingName)
+	case AddIndex, DropIndex:
+		return fmt.Sprintf("%s %s (%s)", c.Kind, c.Index.Name, strings.Join(c.Index.Columns(), ", "))
+	}
+	return string(c.Kind)
+}
+
+// Plan is the list of changes turning Live, a table in the database, into the table of Model
+type Plan struct {
+	Table   string
+	Model   *Schema
+	Live    *Schema
+	Changes []Change
+}
+
+// Empty reports whether the table is up to date
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Has reports whether the plan has changes of kind
+func (p *Plan) Has(kind ChangeKind) bool {
+	for _, change := range p.Changes {
+		if change.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for _, change := range p.Changes {
+		sb.WriteString(p.Table + ": " + change.String() + "\n")
+	}
+	return sb.String()
+}
+
+// Diff returns the plan turning live, the schema of a table introspected by FromTable
+// or nil if it doesn't exist, into the table of model. A NOT NULL column without default
+// can't be added, as the rows of the table would have no value for it.
+func Diff(model, live *Schema) (*Plan, error) {
+	plan := &Plan{Table: model.Name, Model: model, Live: live}
+	if live == nil {
+		plan.Changes = append(plan.Changes, Change{Kind: CreateTable})
+		return plan, nil
+	}
+	renamed := make(map[*Field]bool)
+	for _, field := range model.Fields {
+		column := live.lookupColumn(field.MappingName)
+		if column == nil && field.RenamedFrom != "" {
+			if column = live.lookupColumn(field.RenamedFrom); column != nil {
+				renamed[column] = true
+				plan.Changes = append(plan.Changes, Change{Kind: RenameColumn, Field: field, Live: column})
+			}
+		}
+		if column == nil {
+			if field.NotNull && field.Default == "" {
+				return nil, fmt.Errorf("can't add NOT NULL column %s to table %s without a default, "+
+					"set one by the default tag", field.MappingName, model.Name)
+			}
+			plan.Changes = append(plan.Changes, Change{Kind: AddColumn, Field: field})
+		} else if details := diffColumn(field, column); len(details) > 0 {
+			plan.Changes = append(plan.Changes, Change{Kind: AlterColumn, Field: field, Live: column, Details: details})
+		}
+	}
+	for _, column := range live.Fields {
+		if model.lookupColumn(column.MappingName) == nil && !renamed[column] {
+			plan.Changes = append(plan.Changes, Change{Kind: DropColumn, Live: column})
+		}
+	}
+	for _, index := range live.Indexes {
+		if modelIndex := model.indexByName(index.Name); modelIndex == nil || !sameIndex(modelIndex, index) {
+			plan.Changes = append(plan.Changes, Change{Kind: DropIndex, Index: index})
+		}
+	}
+	for _, index := range model.Indexes {
+		if liveIndex := live.indexByName(index.Name); liveIndex == nil || !sameIndex(index, liveIndex) {
+			plan.Changes = append(plan.Changes, Change{Kind: AddIndex, Index: index})
+		}
+	}
+	return plan, nil
+}
+
+// diffColumn returns what differs between the column of field and the live one
+func diffColumn(field, live *Field) []string {
+	var details []string
+	if normalizeType(field.Type) != normalizeType(live.Type) {
+		details = append(details, fmt.Sprintf("type: %s -> %s", live.Type, field.Type))
+	}
+	if field.PrimaryKey != live.PrimaryKey {
+		details = append(details, fmt.Sprintf("primary key: %t -> %t", live.PrimaryKey, field.PrimaryKey))
+	}
+	// primary keys are implicitly not null in some databases
+	if !field.PrimaryKey && field.NotNull != live.NotNull {
+		details = append(details, fmt.Sprintf("not null: %t -> %t", live.NotNull, field.NotNull))
+	}
+	if normalizeDefault(field.Default) != normalizeDefault(live.Default) {
+		details = append(details, fmt.Sprintf("default: %q -> %q", live.Default, field.Default))
+	}
+	return details
+}
+
+func sameIndex(a, b *Index) bool {
+	columns, liveColumns := a.Columns(), b.Columns()
+	if a.Unique != b.Unique || len(columns) != len(liveColumns) || normalizeSQL(a.Where) != normalizeSQL(b.Where) {
+		return false
+	}
+	for i := range columns {
+		if !strings.EqualFold(columns[i], liveColumns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeAliases maps the names of the same type to one of them
+var typeAliases = map[string]string{
+	"int":                      "integer",
+	"int4":                     "integer",
+	"int8":                     "bigint",
+	"int2":                     "smallint",
+	"bool":                     "boolean",
+	"float8":                   "double precision",
+	"float4":                   "real",
+	"character varying":        "varchar",
+	"timestamp with time zone": "timestamptz",
+}
+
+func normalizeType(typ string) string {
+	typ = strings.ToLower(strings.Join(strings.Fields(typ), " "))
+	typ = strings.ReplaceAll(strings.ReplaceAll(typ, " (", "("), ", ", ",")
+	if alias, ok := typeAliases[typ]; ok {
+		return alias
+	}
+	return typ
+}
+
+// normalizeDefault strips the casts and parentheses databases add to default values, e.g. 'a'::text
+func normalizeDefault(value string) string {
+	value = strings.TrimSpace(value)
+	for strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	if i := strings.LastIndex(value, "::"); i > 0 && !strings.Contains(value[i:], "'") {
+		value = value[:i]
+	}
+	return value
+}
+
+// normalizeSQL makes conditions written differently comparable, e.g. (age > 18) and age>18
+func normalizeSQL(sql string) string {
+	sql = normalizeDefault(sql)
+	return strings.ToLower(strings.Join(strings.Fields(sql), ""))
+}
@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Index is an index of a table declared by the index and uniqueIndex tags, e.g.
+// `orm:"index"`, `orm:"uniqueIndex:idx_email"` or `orm:"index:idx_name,priority:2,where:age > 18"`.
+// Fields sharing an index name form a composite index ordered by priority,
+// where must be the last option as the condition may hold commas.
+type Index struct {
+	Name   string
+	Unique bool
+	// Where makes a partial index of the rows matching the condition
+	Where  string
+	Fields []IndexField
+}
+
+// IndexField is a field of an index
+type IndexField struct {
+	*Field
+	// Priority orders the fields of a composite index, lower first, 10 by default
+	Priority int
+}
+
+// Columns returns the column names of the index in order
+func (index *Index) Columns() []string {
+	var columns []string
+	for _, field := range index.Fields {
+		columns = append(columns, field.MappingName)
+	}
+	return columns
+}
+
+// LookupIndex returns the index named name, or the first index of the field named name, nil if there is none
+func (schema *Schema) LookupIndex(name string) *Index {
+	if index := schema.indexByName(name); index != nil {
+		return index
+	}
+	if field := schema.GetField(name); field != nil {
+		for _, index := range schema.Indexes {
+			for _, f := range index.Fields {
+				if f.Field == field {
+					return index
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (schema *Schema) indexByName(name string) *Index {
+	for _, index := range schema.Indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// parseIndexes adds field to the indexes declared in its tag settings
+func (schema *Schema) parseIndexes(field *Field, settings map[string]string) {
+	for _, key := range []string{"index", "uniqueindex"} {
+		value, ok := settings[key]
+		if !ok {
+			continue
+		}
+		name, priority, where, unique := parseIndexOptions(value)
+		unique = unique || key == "uniqueindex"
+		if name == "" {
+			prefix := "idx_"
+			if unique {
+				prefix = "uidx_"
+			}
+			name = prefix + schema.Name + "_" + field.MappingName
+		}
+		index := schema.indexByName(name)
+		if index == nil {
+			index = &Index{Name: name}
+			schema.Indexes = append(schema.Indexes, index)
+		}
+		index.Unique = index.Unique || unique
+		if where != "" {
+			index.Where = where
+		}
+		index.Fields = append(index.Fields, IndexField{Field: field, Priority: priority})
+		sort.SliceStable(index.Fields, func(i, j int) bool {
+			return index.Fields[i].Priority < index.Fields[j].Priority
+		})
+	}
+}
+
+// parseIndexOptions parses the value of an index tag, like idx_name,unique,priority:2,where:age > 18
+func parseIndexOptions(value string) (name string, priority int, where string, unique bool) {
+	priority = 10
+	options := strings.Split(value, ",")
+	for i, option := range options {
+		key, v, _ := strings.Cut(option, ":")
+		switch key = strings.TrimSpace(key); strings.ToLower(key) {
+		case "unique":
+			unique = true
+		case "priority":
+			if p, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				priority = p
+			}
+		case "where":
+			where = strings.TrimSpace(strings.Join(append([]string{v}, options[i+1:]...), ","))
+			return
+		default:
+			if i == 0 {
+				name = key
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Namer decides the table and column names of models without a name tag.
+// A Namer is part of the schema cache key, so implementations must be comparable.
+type Namer interface {
+	// TableName converts the Go type name of a model to a table name
+	TableName(name string) string
+	// ColumnName converts the Go field name of a model to a column name
+	ColumnName(name string) string
+}
+
+// Tabler is implemented by models which choose their own table name,
+// it takes precedence over the Namer
+type Tabler interface {
+	TableName() string
+}
+
+// DefaultNamer keeps Go names as they are
+type DefaultNamer struct{}
+
+func (DefaultNamer) TableName(name string) string  { return name }
+func (DefaultNamer) ColumnName(name string) string { return name }
+
+// SnakeNamer converts Go names to snake_case, e.g. UserID -> user_id
+type SnakeNamer struct{}
+
+func (SnakeNamer) TableName(name string) string  { return toSnake(name) }
+func (SnakeNamer) ColumnName(name string) string { return toSnake(name) }
+
+// PrefixNamer prepends Prefix to the table names given by Namer
+type PrefixNamer struct {
+	Prefix string
+	Namer  Namer
+}
+
+func (n PrefixNamer) TableName(name string) string {
+	return n.Prefix + orDefault(n.Namer).TableName(name)
+}
+
+func (n PrefixNamer) ColumnName(name string) string {
+	return orDefault(n.Namer).ColumnName(name)
+}
+
+// PluralNamer pluralizes the table names given by Namer, e.g. User -> Users
+type PluralNamer struct {
+	Namer Namer
+}
+
+func (n PluralNamer) TableName(name string) string {
+	return pluralize(orDefault(n.Namer).TableName(name))
+}
+
+func (n PluralNamer) ColumnName(name string) string {
+	return orDefault(n.Namer).ColumnName(name)
+}
+
+func orDefault(namer Namer) Namer {
+	if namer == nil {
+		return DefaultNamer{}
+	}
+	return namer
+}
+
+func toSnake(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word after a lower case letter or digit, or at the
+			// last upper case letter of an acronym, e.g. HTTPServer -> http_server
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+var irregularPlurals = map[string]string{
+	"person": "people",
+	"child":  "children",
+	"man":    "men",
+	"woman":  "women",
+}
+
+func pluralize(name string) string {
+	lower := strings.ToLower(name)
+	for singular, plural := range irregularPlurals {
+		if lower == singular || strings.HasSuffix(lower, "_"+singular) {
+			rest := name[len(name)-len(singular):]
+			if unicode.IsUpper(rune(rest[0])) {
+				plural = strings.ToUpper(plural[:1]) + plural[1:]
+			}
+			return name[:len(name)-len(singular)] + plural
+		}
+	}
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
@@ -0,0 +1,320 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"go/ast"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RelationshipType is the kind of association between two models
+type RelationshipType string
+
+const (
+	// HasOne is a struct field whose model holds a foreign key to the owner
+	HasOne RelationshipType = "has_one"
+	// HasMany is a slice field whose model holds a foreign key to the owner
+	HasMany RelationshipType = "has_many"
+	// BelongsTo is a struct field referenced by a foreign key of the owner
+	BelongsTo RelationshipType = "belongs_to"
+	// ManyToMany is a slice field linked to the owner by the rows of a join table
+	ManyToMany RelationshipType = "many_to_many"
+)
+
+// Relationship is a field of a model holding associated records instead of a column.
+// The foreignKey and references tags override the names of the joined fields,
+// joinForeignKey and joinReferences those of the join table of a many2many tag.
+type Relationship struct {
+	Name string
+	Type RelationshipType
+	// FieldType is the struct type of the associated model
+	FieldType reflect.Type
+	// Index is the index path of the field in the owner, see reflect.Value.FieldByIndex
+	Index []int
+	// ForeignKey is the Go name of the foreign key, a field of the owner for BelongsTo
+	// and of the associated model otherwise
+	ForeignKey string
+	// References is the Go name of the field the foreign key refers to, empty for the primary key.
+	// For ManyToMany, ForeignKey and References are the fields of the join table referring to
+	// the primary keys of the owner and of the associated model.
+	References string
+	// Many2Many is the name of the join table of a ManyToMany relationship
+	Many2Many string
+	// OnDelete and OnUpdate are the referential actions of the foreign key, e.g. CASCADE
+	OnDelete string
+	OnUpdate string
+
+	owner     *Schema
+	once      sync.Once
+	related   *Schema
+	joinOnce  sync.Once
+	joinTable *Schema
+}
+
+// Schema returns the schema of the associated model
+func (rel *Relationship) Schema() *Schema {
+	rel.once.Do(func() {
+		rel.related = ParseWithNamer(reflect.New(rel.FieldType).Interface(), rel.owner.dialect, rel.owner.namer)
+	})
+	return rel.related
+}
+
+// Settable returns the relationship field of dest for assignment, allocating nil embedded pointers on the way
+func (rel *Relationship) Settable(dest reflect.Value) reflect.Value {
+	return settableByIndex(dest, rel.Index)
+}
+
+// JoinTable returns the schema of the join table of a ManyToMany relationship, nil otherwise.
+// It has no model type of its own: its fields, the two keys, form a composite primary key.
+func (rel *Relationship) JoinTable() *Schema {
+	if rel.Type != ManyToMany {
+		return nil
+	}
+	rel.joinOnce.Do(func() {
+		ownerPrimary, relatedPrimary := rel.owner.PrimaryField, rel.Schema().PrimaryField
+		if ownerPrimary == nil || relatedPrimary == nil {
+			return
+		}
+		if rel.References == "" {
+			rel.References = rel.FieldType.Name() + relatedPrimary.Name
+		}
+		// e.g. both UserID when users are linked to users
+		if rel.References == rel.ForeignKey {
+			return
+		}
+		modelType := reflect.StructOf([]reflect.StructField{
+			{Name: rel.ForeignKey, Type: rel.owner.fieldType(ownerPrimary), Tag: `orm:"pk"`},
+			{Name: rel.References, Type: rel.Schema().fieldType(relatedPrimary), Tag: `orm:"pk"`},
+		})
+		rel.joinTable = parse(modelType, rel.owner.dialect, rel.owner.namer)
+		rel.joinTable.Name = rel.Many2Many
+		// links go with the records they link by default
+		onDelete := rel.OnDelete
+		if onDelete == "" {
+			onDelete = "CASCADE"
+		}
+		rel.joinTable.joinKeys = []*Constraint{
+			newConstraint(rel.joinTable, rel.joinTable.Fields[0], rel.owner, ownerPrimary, onDelete, rel.OnUpdate),
+			newConstraint(rel.joinTable, rel.joinTable.Fields[1], rel.Schema(), relatedPrimary, onDelete, rel.OnUpdate),
+		}
+	})
+	return rel.joinTable
+}
+
+// OwnerField returns the field of the owner joining the associated model:
+// the foreign key for BelongsTo, the referenced field otherwise
+func (rel *Relationship) OwnerField() *Field {
+	switch rel.Type {
+	case BelongsTo:
+		return rel.owner.GetField(rel.ForeignKey)
+	case ManyToMany:
+		return rel.owner.PrimaryField
+	}
+	return referencedField(rel.owner, rel.References)
+}
+
+// RelatedField returns the field of the associated model joining the owner:
+// the referenced field for BelongsTo, the foreign key otherwise
+func (rel *Relationship) RelatedField() *Field {
+	switch rel.Type {
+	case BelongsTo:
+		return referencedField(rel.Schema(), rel.References)
+	case ManyToMany:
+		return rel.Schema().PrimaryField
+	}
+	return rel.Schema().GetField(rel.ForeignKey)
+}
+
+// fieldType returns the Go type of field
+func (schema *Schema) fieldType(field *Field) reflect.Type {
+	return reflect.TypeOf(schema.Model).Elem().FieldByIndex(field.Index).Type
+}
+
+func referencedField(schema *Schema, name string) *Field {
+	if name == "" {
+		return schema.PrimaryField
+	}
+	return schema.GetField(name)
+}
+
+// Relationship returns the relationship of field name, nil if there is none
+func (schema *Schema) Relationship(name string) *Relationship {
+	for _, rel := range schema.Relationships {
+		if rel.Name == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// associatedType returns the struct type held by a relationship field of type typ,
+// and whether the field holds a slice of it. Struct types stored in a single column,
+// like time.Time and custom column types, are not associations.
+func associatedType(typ reflect.Type, settings map[string]string, d dialect.Dialect) (reflect.Type, bool, bool) {
+	if _, ok := settings["serializer"]; ok {
+		return nil, false, false
+	}
+	if _, ok := settings["type"]; ok {
+		return nil, false, false
+	}
+	isSlice := typ.Kind() == reflect.Slice
+	if isSlice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == reflect.TypeOf(time.Time{}) ||
+		typ.Implements(valuerType) || reflect.PointerTo(typ).Implements(scannerType) ||
+		reflect.PointerTo(typ).Implements(reflect.TypeOf((*DataTyper)(nil)).Elem()) {
+		return nil, false, false
+	}
+	if _, ok := dialect.LookupType(typ, dialect.NameOf(d)); ok {
+		return nil, false, false
+	}
+	return typ, isSlice, true
+}
+
+// parseRelationship returns the relationship of field p of modelType, nil if p isn't one,
+// the foreign key is decided once all fields are parsed, see resolveRelationships
+func parseRelationship(p reflect.StructField, modelType, fieldType reflect.Type, isSlice bool, settings map[string]string) *Relationship {
+	rel := &Relationship{
+		Name:       p.Name,
+		FieldType:  fieldType,
+		ForeignKey: settings["foreignkey"],
+		References: settings["references"],
+		OnDelete:   settings["ondelete"],
+		OnUpdate:   settings["onupdate"],
+	}
+	switch joinTable, ok := settings["many2many"]; {
+	case ok && isSlice:
+		rel.Type = ManyToMany
+		rel.Many2Many = joinTable
+		rel.ForeignKey = settings["joinforeignkey"]
+		rel.References = settings["joinreferences"]
+	case isSlice:
+		rel.Type = HasMany
+	case rel.ForeignKey != "":
+		// a foreign key of the owner makes it a belongs to
+		if _, ok := modelType.FieldByName(rel.ForeignKey); ok {
+			rel.Type = BelongsTo
+		} else {
+			rel.Type = HasOne
+		}
+	default:
+		references := rel.References
+		if references == "" {
+			references = "ID"
+		}
+		if _, ok := modelType.FieldByName(p.Name + references); ok {
+			rel.Type = BelongsTo
+			rel.ForeignKey = p.Name + references
+			break
+		}
+		// a struct without a foreign key to the owner isn't associated, e.g. a point stored
+		// in a column, it fails as a column of unknown type
+		if rel.References == "" {
+			references = primaryKeyName(modelType)
+		}
+		if _, ok := fieldType.FieldByName(modelType.Name() + references); !ok {
+			return nil
+		}
+		rel.Type = HasOne
+	}
+	return rel
+}
+
+// primaryKeyName returns the Go name of the field parse takes as the primary key of modelType
+func primaryKeyName(modelType reflect.Type) string {
+	for _, p := range reflect.VisibleFields(modelType) {
+		if p.Anonymous || !ast.IsExported(p.Name) {
+			continue
+		}
+		settings := parseTagSetting(p.Tag.Get("orm"))
+		_, pk := settings["pk"]
+		_, primaryKey := settings["primarykey"]
+		if pk || primaryKey || strings.Contains(strings.ToUpper(settings["constraint"]), "PRIMARY KEY") {
+			return p.Name
+		}
+	}
+	return "ID"
+}
+
+// resolveRelationships fills the default foreign keys of has one, has many and
+// many to many relationships, named after the owner and its referenced field, e.g. UserID
+func (schema *Schema) resolveRelationships(modelType reflect.Type) {
+	for _, rel := range schema.Relationships {
+		rel.owner = schema
+		if rel.Type == BelongsTo || rel.ForeignKey != "" {
+			continue
+		}
+		if rel.Type == ManyToMany {
+			if schema.PrimaryField != nil {
+				rel.ForeignKey = modelType.Name() + schema.PrimaryField.Name
+			}
+			continue
+		}
+		if references := referencedField(schema, rel.References); references != nil {
+			rel.ForeignKey = modelType.Name() + references.Name
+		}
+	}
+}
+
+// JoinFields returns OwnerField and RelatedField, failing when either can't be found
+func (rel *Relationship) JoinFields() (*Field, *Field, error) {
+	ownerField, relatedField := rel.OwnerField(), rel.RelatedField()
+	if ownerField == nil || relatedField == nil {
+		return nil, nil, fmt.Errorf("invalid relationship %s of %s: foreign key %s not found", rel.Name, rel.owner.Name, rel.ForeignKey)
+	}
+	if rel.Type == ManyToMany && rel.JoinTable() == nil {
+		return nil, nil, fmt.Errorf("invalid relationship %s of %s: join table keys are both %s, set them by the joinForeignKey and joinReferences tags",
+			rel.Name, rel.owner.Name, rel.ForeignKey)
+	}
+	return ownerField, relatedField, nil
+}
+
+// Constraint is a foreign key of a table, Field refers to ReferencedField of References
+type Constraint struct {
+	Name            string
+	Field           *Field
+	References      *Schema
+	ReferencedField *Field
+	OnDelete        string
+	OnUpdate        string
+}
+
+func newConstraint(table *Schema, field *Field, references *Schema, referencedField *Field, onDelete, onUpdate string) *Constraint {
+	return &Constraint{
+		Name:            "fk_" + table.Name + "_" + field.MappingName,
+		Field:           field,
+		References:      references,
+		ReferencedField: referencedField,
+		OnDelete:        onDelete,
+		OnUpdate:        onUpdate,
+	}
+}
+
+// ForeignKeys returns the foreign keys of the table: those of its belongs to relationships,
+// or those referring to both sides for a join table. Has one and has many relationships
+// declare none, their foreign key is a column of the associated table, which may declare
+// a belongs to relationship back.
+func (schema *Schema) ForeignKeys() []*Constraint {
+	if schema.joinKeys != nil {
+		return schema.joinKeys
+	}
+	var constraints []*Constraint
+	for _, rel := range schema.Relationships {
+		if rel.Type != BelongsTo {
+			continue
+		}
+		ownerField, relatedField, err := rel.JoinFields()
+		if err != nil {
+			continue
+		}
+		constraints = append(constraints, newConstraint(schema, ownerField, rel.Schema(), relatedField, rel.OnDelete, rel.OnUpdate))
+	}
+	return constraints
+}
@@ -1,10 +1,16 @@
 package schema
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"github.com/go-needle/orm/dialect"
 	"go/ast"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Field represents a column of database
@@ -13,67 +19,381 @@ type Field struct {
 	MappingName string
 	Type        string
 	Constraint  string
+	// Serializer converts the field from and to its column value when set by the serializer tag
+	Serializer Serializer
+	// Nullable is set for pointer and sql.Null* fields, which map NULL to nil and Valid = false
+	Nullable bool
+	// AutoCreateTime is the unit of a creation time field filled by Insert
+	AutoCreateTime TimeUnit
+	// AutoUpdateTime is the unit of a modification time field filled by Insert, Update and Save
+	AutoUpdateTime TimeUnit
+	// PrimaryKey is set by the pk tag or a PRIMARY KEY constraint
+	PrimaryKey bool
+	// NotNull is set by the notNull tag or a NOT NULL constraint
+	NotNull bool
+	// Default is the default value of the column set by the default tag or a DEFAULT constraint, as SQL
+	Default string
+	// RenamedFrom is the former name of the column set by the renamedFrom tag, migrations rename it
+	RenamedFrom string
+	// Version is set for the version field used for optimistic locking
+	Version bool
+	// SoftDelete is set for the field marking rows as deleted
+	SoftDelete SoftDelete
+	// Index is the index path of the field in the model, see reflect.Value.FieldByIndex
+	Index []int
+
+	isBool bool
 }
 
-// Schema represents a table of database
+// Schema represents a table of database.
+// Schemas are cached and shared, so they must be treated as read-only.
 type Schema struct {
 	Model             any
 	Name              string
 	Fields            []*Field
 	MappingFieldNames []string
-	fieldMap          map[string]*Field
+	// PrimaryField is the primary key, or the field named ID if none is declared
+	PrimaryField  *Field
+	Relationships []*Relationship
+	Indexes       []*Index
+	fieldMap      map[string]*Field
+	dialect       dialect.Dialect
+	namer         Namer
+	// joinKeys are the foreign keys of a join table
+	joinKeys []*Constraint
 }
 
 func (schema *Schema) GetField(name string) *Field {
 	return schema.fieldMap[name]
 }
 
+// ValueType returns the Go type of the values of a field of the model, the type held by a nullable one
+func (schema *Schema) ValueType(field *Field) reflect.Type {
+	typ, _ := indirectNullable(schema.fieldType(field))
+	return typ
+}
+
+// VersionField returns the version field of the schema, nil if there is none
+func (schema *Schema) VersionField() *Field {
+	for _, field := range schema.Fields {
+		if field.Version {
+			return field
+		}
+	}
+	return nil
+}
+
+type cacheKey struct {
+	modelType reflect.Type
+	dialect   dialect.Dialect
+	namer     Namer
+}
+
+// schemaCache maps cacheKey to *Schema
+var schemaCache sync.Map
+
+// Parse returns the schema of dest named by DefaultNamer
 func Parse(dest any, d dialect.Dialect) *Schema {
+	return ParseWithNamer(dest, d, DefaultNamer{})
+}
+
+// ParseWithNamer returns the schema of dest, it is parsed once per model type, dialect and namer
+func ParseWithNamer(dest any, d dialect.Dialect, namer Namer) *Schema {
+	namer = orDefault(namer)
 	modelType := reflect.Indirect(reflect.ValueOf(dest)).Type()
+	key := cacheKey{modelType: modelType, dialect: d, namer: namer}
+	if v, ok := schemaCache.Load(key); ok {
+		return v.(*Schema)
+	}
+	v, _ := schemaCache.LoadOrStore(key, parse(modelType, d, namer))
+	return v.(*Schema)
+}
+
+func parse(modelType reflect.Type, d dialect.Dialect, namer Namer) *Schema {
+	model := reflect.New(modelType).Interface()
 	schema := &Schema{
-		Model:    dest,
-		Name:     modelType.Name(),
+		Model:    model,
+		Name:     namer.TableName(modelType.Name()),
 		fieldMap: make(map[string]*Field),
+		dialect:  d,
+		namer:    namer,
+	}
+	if tabler, ok := model.(Tabler); ok {
+		schema.Name = tabler.TableName()
 	}
 
-	for i := 0; i < modelType.NumField(); i++ {
-		p := modelType.Field(i)
-		if !p.Anonymous && ast.IsExported(p.Name) {
-			field := &Field{
-				Name:        p.Name,
-				MappingName: p.Name,
-				Type:        d.DataTypeOf(reflect.Indirect(reflect.New(p.Type))),
+	schema.parseFields(modelType, nil, "", "", d, namer)
+	for _, field := range schema.Fields {
+		if field.PrimaryKey {
+			schema.PrimaryField = field
+			break
+		}
+	}
+	if schema.PrimaryField == nil {
+		schema.PrimaryField = schema.GetField("ID")
+	}
+	schema.resolveRelationships(modelType)
+	return schema
+}
+
+// parseFields adds the columns of struct type typ, whose fields are reached
+// through index and named with the given Go name and column name prefixes
+func (schema *Schema) parseFields(typ reflect.Type, index []int, namePrefix, columnPrefix string, d dialect.Dialect, namer Namer) {
+	for i := 0; i < typ.NumField(); i++ {
+		p := typ.Field(i)
+		settings := parseTagSetting(p.Tag.Get("orm"))
+		fieldIndex := append(append([]int(nil), index...), i)
+		if structType, ok := embeddedStruct(p, settings); ok {
+			if p.Anonymous {
+				schema.parseFields(structType, fieldIndex, namePrefix, columnPrefix+settings["prefix"], d, namer)
+			} else {
+				schema.parseFields(structType, fieldIndex, namePrefix+p.Name+".", columnPrefix+settings["prefix"], d, namer)
+			}
+			continue
+		}
+		if p.Anonymous || !ast.IsExported(p.Name) {
+			continue
+		}
+		if fieldType, isSlice, ok := associatedType(p.Type, settings, d); ok {
+			if rel := parseRelationship(p, reflect.TypeOf(schema.Model).Elem(), fieldType, isSlice, settings); rel != nil {
+				rel.Name = namePrefix + rel.Name
+				rel.Index = fieldIndex
+				schema.Relationships = append(schema.Relationships, rel)
+				continue
 			}
-			if v, ok := p.Tag.Lookup("orm"); ok {
-				tags := strings.Split(v, ";")
-				for _, tag := range tags {
-					temp := strings.Split(tag, ":")
-					if len(temp) != 2 {
-						continue
-					}
-					key, value := strings.TrimSpace(temp[0]), strings.TrimSpace(temp[1])
-					switch key {
-					case "name":
-						field.MappingName = value
-					case "constraint":
-						field.Constraint = value
-					}
-				}
+		}
+		valueType, nullable := indirectNullable(p.Type)
+		field := &Field{
+			Name:        namePrefix + p.Name,
+			MappingName: columnPrefix + namer.ColumnName(p.Name),
+			Nullable:    nullable,
+			Index:       fieldIndex,
+		}
+		if name, ok := settings["serializer"]; ok {
+			serializer, ok := GetSerializer(name)
+			if !ok {
+				panic(fmt.Sprintf("unknown serializer %s of field %s", name, p.Name))
 			}
-			schema.Fields = append(schema.Fields, field)
-			schema.MappingFieldNames = append(schema.MappingFieldNames, field.MappingName)
-			schema.fieldMap[p.Name] = field
-			schema.fieldMap[field.MappingName] = field
+			field.Serializer = serializer
+			field.Type = serializedDataType(serializer, settings, d)
+		} else {
+			field.Type = dataTypeOf(valueType, settings, d)
 		}
+		if name, ok := settings["name"]; ok {
+			field.MappingName = columnPrefix + name
+		}
+		if constraint, ok := settings["constraint"]; ok {
+			field.Constraint = constraint
+		}
+		field.AutoCreateTime = autoTime(p, settings, "autoCreateTime", "CreatedAt")
+		field.AutoUpdateTime = autoTime(p, settings, "autoUpdateTime", "UpdatedAt")
+		field.SoftDelete = parseSoftDelete(p, settings)
+		_, field.Version = settings["version"]
+		_, pk := settings["pk"]
+		_, primaryKey := settings["primarykey"]
+		field.PrimaryKey = pk || primaryKey || strings.Contains(strings.ToUpper(field.Constraint), "PRIMARY KEY")
+		_, notNull := settings["notnull"]
+		field.NotNull = notNull || strings.Contains(strings.ToUpper(field.Constraint), "NOT NULL")
+		field.Default = settings["default"]
+		field.RenamedFrom = settings["renamedfrom"]
+		if match := defaultConstraint.FindStringSubmatch(field.Constraint); match != nil && field.Default == "" {
+			field.Default = match[1]
+		}
+		field.isBool = valueType.Kind() == reflect.Bool
+		// a field of an outer struct shadows the promoted one of the same name
+		if _, ok := schema.fieldMap[field.Name]; ok {
+			continue
+		}
+		schema.Fields = append(schema.Fields, field)
+		schema.MappingFieldNames = append(schema.MappingFieldNames, field.MappingName)
+		schema.fieldMap[field.Name] = field
+		schema.fieldMap[field.MappingName] = field
+		schema.parseIndexes(field, settings)
 	}
-	return schema
 }
 
+// embeddedStruct reports whether p is flattened into its parent: an anonymous
+// struct field or one tagged embedded, it returns the struct type to flatten
+func embeddedStruct(p reflect.StructField, settings map[string]string) (reflect.Type, bool) {
+	typ := p.Type
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == reflect.TypeOf(time.Time{}) {
+		return nil, false
+	}
+	// custom column types and serialized fields are stored as a single column
+	if _, ok := settings["serializer"]; ok {
+		return nil, false
+	}
+	if _, ok := settings["type"]; ok || typ.Implements(valuerType) || reflect.PointerTo(typ).Implements(scannerType) {
+		return nil, false
+	}
+	if _, ok := settings["embedded"]; ok && ast.IsExported(p.Name) {
+		return typ, true
+	}
+	// promoted fields of an unexported embedded pointer can't be allocated
+	if p.Anonymous && (ast.IsExported(typ.Name()) || p.Type.Kind() == reflect.Struct) {
+		return typ, true
+	}
+	return nil, false
+}
+
+// DataTyper is implemented by custom column types which declare their SQL type,
+// dialect is the name of the dialect, e.g. sqlite3
+type DataTyper interface {
+	DataType(dialect string) string
+}
+
+// dataTypeOf returns the column type of values of typ, it is decided by the
+// type tag, then DataTyper, then types registered in dialect, then the dialect itself
+func dataTypeOf(typ reflect.Type, settings map[string]string, d dialect.Dialect) string {
+	if dataType, ok := settings["type"]; ok {
+		return dataType
+	}
+	value := reflect.New(typ)
+	if typer, ok := value.Interface().(DataTyper); ok {
+		return typer.DataType(dialect.NameOf(d))
+	}
+	if dataType, ok := dialect.LookupType(typ, dialect.NameOf(d)); ok {
+		return dataType
+	}
+	return d.DataTypeOf(value.Elem())
+}
+
+// defaultConstraint matches the value of DEFAULT in a constraint, a quoted string or a single token
+var defaultConstraint = regexp.MustCompile(`(?i)\bDEFAULT\s+('(?:[^']|'')*'|\([^)]*\)|[^\s,]+)`)
+
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// indirectNullable returns the type of the value held by a field of type typ,
+// and whether the field can hold NULL: a pointer, or a sql.Null* like struct
+// with the value followed by a Valid flag, such as sql.NullString or sql.Null[T]
+func indirectNullable(typ reflect.Type) (reflect.Type, bool) {
+	if typ.Kind() == reflect.Pointer {
+		return typ.Elem(), true
+	}
+	if typ.Kind() == reflect.Struct && typ.NumField() == 2 &&
+		typ.Field(1).Name == "Valid" && typ.Field(1).Type.Kind() == reflect.Bool &&
+		typ.Implements(valuerType) && reflect.PointerTo(typ).Implements(scannerType) {
+		return typ.Field(0).Type, true
+	}
+	return typ, false
+}
+
+// parseTagSetting splits an orm tag like `name:user_name;embedded` into
+// lower-cased keys and their values, keys without a value map to ""
+func parseTagSetting(tag string) map[string]string {
+	settings := make(map[string]string)
+	for _, item := range strings.Split(tag, ";") {
+		kv := strings.SplitN(item, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if key == "" {
+			continue
+		}
+		if len(kv) == 2 {
+			settings[key] = strings.TrimSpace(kv[1])
+		} else {
+			settings[key] = ""
+		}
+	}
+	return settings
+}
+
+// ValueOf returns the field of dest, it is invalid when an embedded pointer on the way is nil
+func (field *Field) ValueOf(dest reflect.Value) reflect.Value {
+	v, err := dest.FieldByIndexErr(field.Index)
+	if err != nil {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// ScanTarget returns the destination to scan the column of field in dest into,
+// and a func to call after scanning. NULL leaves the zero value in fields that
+// are not nullable.
+func (field *Field) ScanTarget(dest reflect.Value) (any, func() error) {
+	v := field.Settable(dest)
+	if field.Serializer != nil {
+		var data []byte
+		return &data, func() error {
+			if len(data) == 0 {
+				v.SetZero()
+				return nil
+			}
+			return field.Serializer.Unmarshal(data, v.Addr().Interface())
+		}
+	}
+	if field.Nullable || v.Addr().Type().Implements(scannerType) {
+		return v.Addr().Interface(), func() error { return nil }
+	}
+	ptr := reflect.New(reflect.PointerTo(v.Type()))
+	return ptr.Interface(), func() error {
+		if ptr.Elem().IsNil() {
+			v.SetZero()
+		} else {
+			v.Set(ptr.Elem().Elem())
+		}
+		return nil
+	}
+}
+
+// Settable returns the field of dest for assignment, allocating nil embedded pointers on the way
+func (field *Field) Settable(dest reflect.Value) reflect.Value {
+	return settableByIndex(dest, field.Index)
+}
+
+func settableByIndex(dest reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && dest.Kind() == reflect.Pointer {
+			if dest.IsNil() {
+				dest.Set(reflect.New(dest.Type().Elem()))
+			}
+			dest = dest.Elem()
+		}
+		dest = dest.Field(x)
+	}
+	return dest
+}
+
+// RecordValues returns the column values of dest, nil for the fields failing to serialize
+//
+// Deprecated: use RecordValuesErr, which reports the fields failing to serialize.
 func (schema *Schema) RecordValues(dest any) []any {
 	destValue := reflect.Indirect(reflect.ValueOf(dest))
 	var fieldValues []any
 	for _, field := range schema.Fields {
-		fieldValues = append(fieldValues, destValue.FieldByName(field.Name).Interface())
+		value, _ := field.DBValue(field.ValueOf(destValue))
+		fieldValues = append(fieldValues, value)
 	}
 	return fieldValues
 }
+
+// RecordValuesErr returns the column values of dest, serializing the fields with a serializer
+func (schema *Schema) RecordValuesErr(dest any) ([]any, error) {
+	destValue := reflect.Indirect(reflect.ValueOf(dest))
+	var fieldValues []any
+	for _, field := range schema.Fields {
+		value, err := field.DBValue(field.ValueOf(destValue))
+		if err != nil {
+			return nil, err
+		}
+		fieldValues = append(fieldValues, value)
+	}
+	return fieldValues, nil
+}
+
+// DBValue converts v, a value of field, to the value to store in its column,
+// nil pointers and invalid values are NULL
+func (field *Field) DBValue(v reflect.Value) (any, error) {
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, nil
+	}
+	if field.Serializer != nil {
+		return serialize(field.Serializer, v.Interface())
+	}
+	return v.Interface(), nil
+}
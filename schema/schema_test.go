@@ -1,9 +1,13 @@
 package schema
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"github.com/go-needle/orm/dialect"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type User struct {
@@ -23,3 +27,313 @@ func TestParse(t *testing.T) {
 		t.Fatal("failed to parse primary key")
 	}
 }
+
+func TestParse_Cache(t *testing.T) {
+	schema := Parse(&User{}, TestDial)
+	if Parse(User{}, TestDial) != schema {
+		t.Fatal("failed to reuse cached schema")
+	}
+	if _, ok := schema.Model.(*User); !ok {
+		t.Fatal("failed to keep model type, got", schema.Model)
+	}
+}
+
+type UserProfile struct {
+	UserID    int
+	HTTPProxy string
+}
+
+type Person struct {
+	Name string `orm:"name:full_name"`
+}
+
+func (Person) TableName() string {
+	return "sys_person"
+}
+
+func TestParse_Namer(t *testing.T) {
+	schema := ParseWithNamer(&UserProfile{}, TestDial, PrefixNamer{Prefix: "t_", Namer: PluralNamer{Namer: SnakeNamer{}}})
+	if schema.Name != "t_user_profiles" {
+		t.Fatal("failed to name table, got", schema.Name)
+	}
+	if schema.GetField("UserID").MappingName != "user_id" || schema.GetField("HTTPProxy").MappingName != "http_proxy" {
+		t.Fatal("failed to name columns, got", schema.MappingFieldNames)
+	}
+	schema = ParseWithNamer(&Person{}, TestDial, SnakeNamer{})
+	if schema.Name != "sys_person" || schema.GetField("Name").MappingName != "full_name" {
+		t.Fatal("failed to prefer TableName and name tag, got", schema.Name, schema.MappingFieldNames)
+	}
+	for singular, plural := range map[string]string{"Address": "Addresses", "category": "categories", "Day": "Days", "Person": "People"} {
+		if got := pluralize(singular); got != plural {
+			t.Fatalf("failed to pluralize %s, got %s", singular, got)
+		}
+	}
+}
+
+type BaseModel struct {
+	ID   int `orm:"constraint:PRIMARY KEY"`
+	Note string
+}
+
+type Address struct {
+	City string
+}
+
+type Member struct {
+	*BaseModel
+	Name string
+	Home Address `orm:"embedded;prefix:home_"`
+}
+
+func TestParse_Embedded(t *testing.T) {
+	schema := Parse(&Member{}, TestDial)
+	if !reflect.DeepEqual(schema.MappingFieldNames, []string{"ID", "Note", "Name", "home_City"}) {
+		t.Fatal("failed to flatten embedded structs, got", schema.MappingFieldNames)
+	}
+	if schema.GetField("Home.City").MappingName != "home_City" {
+		t.Fatal("failed to name embedded field")
+	}
+	values := schema.RecordValues(&Member{Name: "Tom", Home: Address{City: "Paris"}})
+	if !reflect.DeepEqual(values, []any{nil, nil, "Tom", "Paris"}) {
+		t.Fatal("failed to record values of nil embedded pointer, got", values)
+	}
+}
+
+type Profile struct {
+	Nick    *string
+	Score   sql.NullInt64
+	Rank    sql.NullFloat64
+	Created *time.Time
+	Name    string
+}
+
+func TestParse_Nullable(t *testing.T) {
+	schema := Parse(&Profile{}, TestDial)
+	types := map[string]string{"Nick": "text", "Score": "bigint", "Rank": "real", "Created": "datetime", "Name": "text"}
+	for name, typ := range types {
+		field := schema.GetField(name)
+		if field.Type != typ || field.Nullable != (name != "Name") {
+			t.Fatalf("failed to parse nullable field %s, got %s %v", name, field.Type, field.Nullable)
+		}
+	}
+	values, _ := schema.RecordValuesErr(&Profile{Name: "Tom"})
+	if values[0] != nil || values[3] != nil {
+		t.Fatal("failed to record nil pointers as NULL, got", values)
+	}
+}
+
+type UUID [16]byte
+
+func (UUID) DataType(dialect string) string {
+	if dialect == "sqlite3" {
+		return "text"
+	}
+	return "uuid"
+}
+
+type Money struct {
+	Cents int64
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.Cents, nil
+}
+
+func (m *Money) Scan(src any) error {
+	m.Cents, _ = src.(int64)
+	return nil
+}
+
+type Level struct {
+	Code string
+}
+
+type Order struct {
+	ID     UUID
+	Amount Money
+	Level  Level `orm:"type:varchar(16)"`
+}
+
+func TestParse_CustomType(t *testing.T) {
+	dialect.RegisterType(reflect.TypeOf(Money{}), map[string]string{"sqlite3": "decimal"})
+	schema := Parse(&Order{}, TestDial)
+	types := map[string]string{"ID": "text", "Amount": "decimal", "Level": "varchar(16)"}
+	for name, typ := range types {
+		if schema.GetField(name).Type != typ {
+			t.Fatalf("failed to parse custom type of %s, got %s", name, schema.GetField(name).Type)
+		}
+	}
+}
+
+type Author struct {
+	ID          int `orm:"pk"`
+	Books       []Book
+	Avatar      *Avatar
+	Banner      *Avatar `orm:"foreignKey:BannerOf"`
+	PublisherID int
+	Publisher   Publisher
+	Born        time.Time
+}
+
+type Book struct {
+	ID       int
+	AuthorID int
+}
+
+type Avatar struct {
+	ID       int
+	AuthorID int
+}
+
+type Publisher struct {
+	ID   int
+	Name string
+}
+
+func TestParse_Relationships(t *testing.T) {
+	schema := Parse(&Author{}, TestDial)
+	if !reflect.DeepEqual(schema.MappingFieldNames, []string{"ID", "PublisherID", "Born"}) {
+		t.Fatal("failed to skip relationship fields, got", schema.MappingFieldNames)
+	}
+	if schema.PrimaryField == nil || schema.PrimaryField.Name != "ID" {
+		t.Fatal("failed to parse primary field")
+	}
+	books, avatar, publisher := schema.Relationship("Books"), schema.Relationship("Avatar"), schema.Relationship("Publisher")
+	if books == nil || books.Type != HasMany || books.ForeignKey != "AuthorID" || books.RelatedField().Name != "AuthorID" {
+		t.Fatal("failed to parse has many relationship", books)
+	}
+	if avatar == nil || avatar.Type != HasOne || avatar.OwnerField().Name != "ID" || avatar.RelatedField().Name != "AuthorID" {
+		t.Fatal("failed to parse has one relationship", avatar)
+	}
+	if _, _, err := schema.Relationship("Banner").JoinFields(); err == nil {
+		t.Fatal("expect an error for a missing foreign key")
+	}
+	if publisher == nil || publisher.Type != BelongsTo || publisher.OwnerField().Name != "PublisherID" || publisher.RelatedField().Name != "ID" {
+		t.Fatal("failed to parse belongs to relationship", publisher)
+	}
+	if publisher.Schema().Name != "Publisher" {
+		t.Fatal("failed to parse related schema")
+	}
+}
+
+type Point struct {
+	X, Y int
+}
+
+type Place struct {
+	ID  int
+	Loc Point
+}
+
+func TestParse_StructColumn(t *testing.T) {
+	// Point has no foreign key to Place, it isn't a has one but a column of unknown type
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect a struct without a foreign key to fail as a column")
+		}
+	}()
+	Parse(&Place{}, TestDial)
+}
+
+type Student struct {
+	ID      int      `orm:"pk"`
+	Courses []Course `orm:"many2many:student_courses"`
+}
+
+type Course struct {
+	Code string `orm:"pk"`
+}
+
+func TestParse_Many2Many(t *testing.T) {
+	rel := ParseWithNamer(&Student{}, TestDial, SnakeNamer{}).Relationship("Courses")
+	if rel == nil || rel.Type != ManyToMany || rel.OwnerField().Name != "ID" || rel.RelatedField().Name != "Code" {
+		t.Fatal("failed to parse many to many relationship", rel)
+	}
+	joinTable := rel.JoinTable()
+	if joinTable.Name != "student_courses" || !reflect.DeepEqual(joinTable.MappingFieldNames, []string{"student_id", "course_code"}) {
+		t.Fatal("failed to parse join table, got", joinTable.Name, joinTable.MappingFieldNames)
+	}
+	if joinTable.GetField("CourseCode").Type != "text" || !joinTable.Fields[0].PrimaryKey || !joinTable.Fields[1].PrimaryKey {
+		t.Fatal("failed to parse join table keys")
+	}
+}
+
+type Account struct {
+	ID        int    `orm:"pk"`
+	Email     string `orm:"uniqueIndex:idx_email"`
+	FirstName string `orm:"index:idx_name,priority:2"`
+	LastName  string `orm:"index:idx_name,priority:1"`
+	Age       int    `orm:"index:,where:Age IN (20, 30)"`
+	OwnerID   int
+	Owner     *Publisher `orm:"onDelete:CASCADE;onUpdate:SET NULL"`
+}
+
+func TestParse_Indexes(t *testing.T) {
+	schema := Parse(&Account{}, TestDial)
+	if len(schema.Indexes) != 3 {
+		t.Fatal("failed to parse indexes, got", len(schema.Indexes))
+	}
+	email, name, age := schema.LookupIndex("idx_email"), schema.LookupIndex("idx_name"), schema.LookupIndex("Age")
+	if email == nil || !email.Unique || !reflect.DeepEqual(email.Columns(), []string{"Email"}) {
+		t.Fatal("failed to parse unique index", email)
+	}
+	if name == nil || name.Unique || !reflect.DeepEqual(name.Columns(), []string{"LastName", "FirstName"}) {
+		t.Fatal("failed to parse composite index", name)
+	}
+	if age == nil || age.Name != "idx_Account_Age" || age.Where != "Age IN (20, 30)" {
+		t.Fatal("failed to parse partial index", age)
+	}
+	fks := schema.ForeignKeys()
+	if len(fks) != 1 || fks[0].Name != "fk_Account_OwnerID" || fks[0].References.Name != "Publisher" ||
+		fks[0].ReferencedField.Name != "ID" || fks[0].OnDelete != "CASCADE" || fks[0].OnUpdate != "SET NULL" {
+		t.Fatal("failed to parse foreign keys", fks)
+	}
+}
+
+type Article struct {
+	ID     int    `orm:"pk"`
+	Title  string `orm:"notNull;index"`
+	Status string `orm:"default:'draft'"`
+	Views  int    `orm:"constraint:NOT NULL DEFAULT 0"`
+}
+
+func TestDiff(t *testing.T) {
+	model := Parse(&Article{}, TestDial)
+	if !model.GetField("Title").NotNull || model.GetField("Status").Default != "'draft'" ||
+		!model.GetField("Views").NotNull || model.GetField("Views").Default != "0" {
+		t.Fatal("failed to parse not null and default")
+	}
+	if plan, err := Diff(model, nil); err != nil || !plan.Has(CreateTable) {
+		t.Fatal("expect a create table plan, got", plan)
+	}
+	live := FromTable("Article", []dialect.ColumnInfo{
+		{Name: "id", Type: "INTEGER", PrimaryKey: true},
+		{Name: "Title", Type: "text", NotNull: true},
+		{Name: "Status", Type: "integer", Default: "'draft'::text"},
+		{Name: "Legacy", Type: "text"},
+	}, []dialect.IndexInfo{
+		{Name: "idx_Article_Title", Columns: []string{"Title"}},
+		{Name: "idx_legacy", Columns: []string{"Legacy"}},
+	})
+	plan, err := Diff(model, live)
+	if err != nil {
+		t.Fatal("failed to diff schema", err)
+	}
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, change.String())
+	}
+	expected := []string{
+		`alter column Status (type: integer -> text)`,
+		`add column Views integer`,
+		`drop column Legacy`,
+		`drop index idx_legacy (Legacy)`,
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatal("failed to diff schema, got", changes)
+	}
+	// Title is NOT NULL without a default, the rows of the table would have no value for it
+	if _, err := Diff(model, FromTable("Article", []dialect.ColumnInfo{{Name: "id", Type: "INTEGER", PrimaryKey: true}}, nil)); err == nil {
+		t.Fatal("expect an error adding a NOT NULL column without default")
+	}
+}
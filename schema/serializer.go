@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/go-needle/orm/dialect"
+	"reflect"
+	"sync"
+)
+
+// Serializer stores a field in a single column, chosen by the serializer tag,
+// e.g. `orm:"serializer:json"`
+type Serializer interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// TextSerializer is implemented by serializers whose output is text,
+// their columns hold strings instead of blobs
+type TextSerializer interface {
+	Serializer
+	IsText() bool
+}
+
+// JSONSerializer stores fields as JSON text
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONSerializer) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (JSONSerializer) IsText() bool                       { return true }
+
+// GobSerializer stores fields as gob encoded blobs
+type GobSerializer struct{}
+
+func (GobSerializer) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	serializersMu sync.RWMutex
+	serializers   = map[string]Serializer{
+		"json": JSONSerializer{},
+		"gob":  GobSerializer{},
+	}
+)
+
+// RegisterSerializer makes a serializer available to the serializer tag by name
+func RegisterSerializer(name string, serializer Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+	serializers[name] = serializer
+}
+
+func GetSerializer(name string) (serializer Serializer, ok bool) {
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+	serializer, ok = serializers[name]
+	return
+}
+
+func isText(serializer Serializer) bool {
+	s, ok := serializer.(TextSerializer)
+	return ok && s.IsText()
+}
+
+// serializedDataType returns the column type of a field stored by serializer
+func serializedDataType(serializer Serializer, settings map[string]string, d dialect.Dialect) string {
+	if dataType, ok := settings["type"]; ok {
+		return dataType
+	}
+	if isText(serializer) {
+		return d.DataTypeOf(reflect.ValueOf(""))
+	}
+	return d.DataTypeOf(reflect.ValueOf([]byte(nil)))
+}
+
+func serialize(serializer Serializer, v any) (any, error) {
+	data, err := serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if isText(serializer) {
+		return string(data), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SoftDelete is the kind of a soft delete field, the zero value is a normal field.
+// Rows of a model with a soft delete field are marked as deleted instead of being removed.
+type SoftDelete int
+
+const (
+	_ SoftDelete = iota
+	// SoftDeleteTime is NULL for live rows and the deletion time for deleted ones
+	SoftDeleteTime
+	// SoftDeleteUnix is 0 for live rows and the deletion time in unix seconds for deleted ones
+	SoftDeleteUnix
+	// SoftDeleteMilli is 0 for live rows and the deletion time in unix milliseconds for deleted ones
+	SoftDeleteMilli
+	// SoftDeleteFlag is false (0) for live rows and true (1) for deleted ones
+	SoftDeleteFlag
+)
+
+// parseSoftDelete returns the kind of soft delete field p: tagged with softDelete,
+// optionally followed by unix, milli or flag, or named DeletedAt by convention
+func parseSoftDelete(p reflect.StructField, settings map[string]string) SoftDelete {
+	tag, ok := settings["softdelete"]
+	if !ok && p.Name != "DeletedAt" {
+		return 0
+	}
+	valueType, _ := indirectNullable(p.Type)
+	switch strings.ToLower(tag) {
+	case "false":
+		return 0
+	case "unix":
+		return SoftDeleteUnix
+	case "milli":
+		return SoftDeleteMilli
+	case "flag":
+		return SoftDeleteFlag
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		return SoftDeleteTime
+	case reflect.Bool:
+		return SoftDeleteFlag
+	}
+	return SoftDeleteUnix
+}
+
+// SoftDeleteField returns the soft delete field of the schema, nil if there is none
+func (schema *Schema) SoftDeleteField() *Field {
+	for _, field := range schema.Fields {
+		if field.SoftDelete != 0 {
+			return field
+		}
+	}
+	return nil
+}
+
+// AliveCondition returns the condition matching the rows not soft deleted
+func (field *Field) AliveCondition() (string, []any) {
+	if field.SoftDelete == SoftDeleteTime {
+		return field.MappingName + " IS NULL", nil
+	}
+	return field.MappingName + " = ?", []any{field.AliveValue()}
+}
+
+// AliveValue returns the value of the soft delete field of rows not deleted
+func (field *Field) AliveValue() any {
+	switch field.SoftDelete {
+	case SoftDeleteTime:
+		return nil
+	case SoftDeleteFlag:
+		if field.isBool {
+			return false
+		}
+	}
+	return 0
+}
+
+// DeletedValue returns the value of the soft delete field of rows deleted at now
+func (field *Field) DeletedValue(now time.Time) any {
+	switch field.SoftDelete {
+	case SoftDeleteUnix:
+		return now.Unix()
+	case SoftDeleteMilli:
+		return now.UnixMilli()
+	case SoftDeleteFlag:
+		if field.isBool {
+			return true
+		}
+		return 1
+	}
+	return now
+}
@@ -0,0 +1,277 @@
+package session
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/go-needle/orm/clause"
+	"github.com/go-needle/orm/schema"
+	"reflect"
+	"strings"
+)
+
+// Preload loads the associations on path with the records found by Find and First,
+// nested associations are separated by dots, e.g. Orders.Items.
+// Each association is loaded by one query with the keys of all records.
+func (s *Session) Preload(path string) *Session {
+	s = s.getInstance()
+	s.preloads = append(s.preloads, path)
+	return s
+}
+
+// Joins loads the has one or belongs to association name with the records in the same query,
+// by a LEFT JOIN aliased name. Qualify ambiguous columns in conditions by table name.
+func (s *Session) Joins(name string) *Session {
+	s = s.getInstance()
+	s.joins = append(s.joins, name)
+	return s
+}
+
+// newSession returns a session sharing the connection, transaction and settings of s with a clean statement
+func (s *Session) newSession() *Session {
+	c := s.Clone()
+	c.immutable = false
+	c.refTable = nil
+	c.Clear()
+	return c
+}
+
+// joinedRelationship is an association loaded by Joins
+type joinedRelationship struct {
+	rel   *schema.Relationship
+	table *schema.Schema
+}
+
+func (s *Session) joinRelationships(table *schema.Schema) ([]*joinedRelationship, error) {
+	var joins []*joinedRelationship
+	for _, name := range s.joins {
+		rel := table.Relationship(name)
+		if rel == nil {
+			return nil, fmt.Errorf("can't join %s: %s has no relationship %s", name, table.Name, name)
+		}
+		if rel.Type != schema.HasOne && rel.Type != schema.BelongsTo {
+			return nil, fmt.Errorf("can't join %s: only has one and belongs to relationships can be joined", name)
+		}
+		if _, _, err := rel.JoinFields(); err != nil {
+			return nil, err
+		}
+		joins = append(joins, &joinedRelationship{rel: rel, table: rel.Schema()})
+	}
+	return joins, nil
+}
+
+// selectJoins sets the SELECT clause of table with the columns of joins, all columns are qualified
+func (s *Session) selectJoins(table *schema.Schema, joins []*joinedRelationship) {
+	var from strings.Builder
+	var columns []string
+	var vars []any
+	from.WriteString(table.Name)
+	for _, name := range table.MappingFieldNames {
+		columns = append(columns, table.Name+"."+name)
+	}
+	for _, join := range joins {
+		alias := join.rel.Name
+		ownerField, relatedField, _ := join.rel.JoinFields()
+		from.WriteString(fmt.Sprintf(" LEFT JOIN %s %s ON %s.%s = %s.%s",
+			join.table.Name, alias, alias, relatedField.MappingName, table.Name, ownerField.MappingName))
+		if field := join.table.SoftDeleteField(); field != nil && !s.unscoped {
+			desc, aliveVars := field.AliveCondition()
+			from.WriteString(" AND " + alias + "." + desc)
+			vars = append(vars, aliveVars...)
+		}
+		for _, name := range join.table.MappingFieldNames {
+			columns = append(columns, alias+"."+name)
+		}
+	}
+	s.clause.Set(clause.SELECT, append([]any{from.String(), columns}, vars...)...)
+	if field := table.SoftDeleteField(); field != nil && !s.unscoped {
+		desc, aliveVars := field.AliveCondition()
+		s.clause.And(table.Name+"."+desc, aliveVars...)
+	}
+}
+
+// scanTargets returns the scan destinations of the joined columns in dest,
+// and a func which assigns them, clearing the association when no record was joined
+func (join *joinedRelationship) scanTargets(dest reflect.Value) ([]any, func() error) {
+	field := join.rel.Settable(dest)
+	target := field
+	if field.Kind() == reflect.Pointer {
+		field.Set(reflect.New(field.Type().Elem()))
+		target = field.Elem()
+	}
+	_, relatedField, _ := join.rel.JoinFields()
+	// the joining column is NULL when no record was joined, whatever its type
+	key := reflect.New(reflect.PointerTo(relatedField.Settable(target).Type()))
+	var values []any
+	var assigns []func() error
+	for _, f := range join.table.Fields {
+		if f == relatedField {
+			values = append(values, key.Interface())
+			continue
+		}
+		value, assign := f.ScanTarget(target)
+		values = append(values, value)
+		assigns = append(assigns, assign)
+	}
+	return values, func() error {
+		if key.Elem().IsNil() {
+			field.SetZero()
+			return nil
+		}
+		relatedField.Settable(target).Set(key.Elem().Elem())
+		for _, assign := range assigns {
+			if err := assign(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// preload loads the associations on paths with the records in destSlice,
+// nested paths sharing the first association load it once
+func (s *Session) preload(destSlice reflect.Value, table *schema.Schema, paths []string) error {
+	var names []string
+	nested := make(map[string][]string)
+	for _, path := range paths {
+		name, rest, _ := strings.Cut(path, ".")
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+	for _, name := range names {
+		if err := s.preloadRelationship(destSlice, table, name, nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) preloadRelationship(destSlice reflect.Value, table *schema.Schema, name string, nested []string) error {
+	rel := table.Relationship(name)
+	if rel == nil {
+		return fmt.Errorf("can't preload %s: %s has no relationship %s", name, table.Name, name)
+	}
+	if rel.Type == schema.ManyToMany {
+		return s.preloadMany2Many(destSlice, rel, nested)
+	}
+	ownerField, relatedField, err := rel.JoinFields()
+	if err != nil {
+		return err
+	}
+	var keys []any
+	seen := make(map[string]bool)
+	for i := 0; i < destSlice.Len(); i++ {
+		v := ownerField.ValueOf(destSlice.Index(i))
+		if key, ok := joinKey(v); ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, v.Interface())
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	related, err := s.findIn(rel.FieldType, relatedField.MappingName, keys, nested)
+	if err != nil {
+		return err
+	}
+
+	items := make(map[string][]reflect.Value)
+	for i := 0; i < related.Len(); i++ {
+		item := related.Index(i)
+		if key, ok := joinKey(relatedField.ValueOf(item)); ok {
+			items[key] = append(items[key], item)
+		}
+	}
+	for i := 0; i < destSlice.Len(); i++ {
+		owner := destSlice.Index(i)
+		key, ok := joinKey(ownerField.ValueOf(owner))
+		if !ok {
+			continue
+		}
+		setAssociation(rel.Settable(owner), items[key])
+	}
+	return nil
+}
+
+// setAssociation sets field, a struct, a pointer to struct or a slice of them, to items
+func setAssociation(field reflect.Value, items []reflect.Value) {
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), 0, len(items))
+		for _, item := range items {
+			if field.Type().Elem().Kind() == reflect.Pointer {
+				item = item.Addr()
+			}
+			slice = reflect.Append(slice, item)
+		}
+		field.Set(slice)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	if field.Kind() == reflect.Pointer {
+		field.Set(items[0].Addr())
+	} else {
+		field.Set(items[0])
+	}
+}
+
+// joinKey returns a comparable key of v, a value of a joining field, false for NULL
+func joinKey(v reflect.Value) (string, bool) {
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		return "", false
+	}
+	value := reflect.Indirect(v).Interface()
+	if valuer, ok := value.(driver.Valuer); ok {
+		var err error
+		if value, err = valuer.Value(); err != nil || value == nil {
+			return "", false
+		}
+	}
+	return fmt.Sprint(value), true
+}
+
+// preloadBatchSize is the most keys bound in the IN list of a preload query,
+// below the limits of the databases on bind vars, e.g. 999 for old SQLite versions
+var preloadBatchSize = 500
+
+// findIn finds the records of typ whose column is in keys, preloading the nested paths,
+// with a query per preloadBatchSize keys
+func (s *Session) findIn(typ reflect.Type, column string, keys []any, nested []string) (reflect.Value, error) {
+	records := reflect.MakeSlice(reflect.SliceOf(typ), 0, len(keys))
+	for _, batch := range batches(keys) {
+		found := reflect.New(records.Type())
+		query := s.newSession().Model(reflect.New(typ).Interface()).
+			Where(fmt.Sprintf("%s IN (%s)", column, bindVars(len(batch))), batch...)
+		for _, path := range nested {
+			query = query.Preload(path)
+		}
+		if err := query.Find(found.Interface()); err != nil {
+			return records, err
+		}
+		records = reflect.AppendSlice(records, found.Elem())
+	}
+	return records, nil
+}
+
+// batches splits keys into slices of preloadBatchSize keys at most
+func batches(keys []any) [][]any {
+	var batches [][]any
+	for len(keys) > preloadBatchSize {
+		batches = append(batches, keys[:preloadBatchSize:preloadBatchSize])
+		keys = keys[preloadBatchSize:]
+	}
+	if len(keys) > 0 {
+		batches = append(batches, keys)
+	}
+	return batches
+}
+
+func bindVars(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,208 @@
+package session
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/dialect"
+	"strings"
+	"testing"
+)
+
+type Buyer struct {
+	ID        int `orm:"pk"`
+	Name      string
+	ProfileID int
+	Profile   *Card
+	Orders    []Purchase
+}
+
+type Card struct {
+	ID    int `orm:"pk"`
+	Level string
+}
+
+type Purchase struct {
+	ID      int `orm:"pk"`
+	BuyerID int
+	Items   []LineItem `orm:"foreignKey:PurchaseID"`
+}
+
+type LineItem struct {
+	ID         int `orm:"pk"`
+	PurchaseID int
+	Sku        string
+}
+
+func testAssociationInit(t *testing.T) *Session {
+	t.Helper()
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d)
+	for _, model := range []any{&Buyer{}, &Card{}, &Purchase{}, &LineItem{}} {
+		_ = s.Model(model).DropTable()
+		if err := s.Model(model).CreateTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err1 := s.Insert(&Buyer{ID: 1, Name: "Tom", ProfileID: 1}, &Buyer{ID: 2, Name: "Sam", ProfileID: 3})
+	_, err2 := s.Insert(&Card{ID: 1, Level: "gold"}, &Card{ID: 2, Level: "silver"})
+	_, err3 := s.Insert(&Purchase{ID: 1, BuyerID: 1}, &Purchase{ID: 2, BuyerID: 1}, &Purchase{ID: 3, BuyerID: 2})
+	_, err4 := s.Insert(&LineItem{1, 1, "a"}, &LineItem{2, 1, "b"}, &LineItem{3, 3, "c"})
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		t.Fatal("failed init test records")
+	}
+	return s.Debug()
+}
+
+func TestSession_Preload(t *testing.T) {
+	s := testAssociationInit(t)
+	var buyers []Buyer
+	if err := s.Preload("Orders.Items").Preload("Profile").OrderBy("ID").Find(&buyers); err != nil {
+		t.Fatal("failed to preload", err)
+	}
+	if len(buyers) != 2 || len(buyers[0].Orders) != 2 || len(buyers[1].Orders) != 1 {
+		t.Fatal("failed to preload has many, got", buyers)
+	}
+	if len(buyers[0].Orders[0].Items) != 2 || len(buyers[0].Orders[1].Items) != 0 || buyers[1].Orders[0].Items[0].Sku != "c" {
+		t.Fatal("failed to preload nested has many, got", buyers)
+	}
+	if buyers[0].Profile == nil || buyers[0].Profile.Level != "gold" || buyers[1].Profile != nil {
+		t.Fatal("failed to preload belongs to, got", buyers[0].Profile, buyers[1].Profile)
+	}
+}
+
+func TestSession_PreloadBatches(t *testing.T) {
+	defer func(size int) { preloadBatchSize = size }(preloadBatchSize)
+	preloadBatchSize = 1
+	s := testAssociationInit(t)
+	var buyers []Buyer
+	if err := s.Preload("Orders.Items").OrderBy("ID").Find(&buyers); err != nil {
+		t.Fatal("failed to preload in batches", err)
+	}
+	if len(buyers) != 2 || len(buyers[0].Orders) != 2 || len(buyers[1].Orders) != 1 ||
+		len(buyers[0].Orders[0].Items) != 2 || buyers[1].Orders[0].Items[0].Sku != "c" {
+		t.Fatal("failed to merge the batches, got", buyers)
+	}
+
+	s = testMany2ManyInit(t)
+	_, err := s.WithAssociations().Insert(&Player{ID: 1, Name: "Tom", Teams: []*Team{{ID: 1, Name: "red"}, {ID: 2, Name: "blue"}}},
+		&Player{ID: 2, Name: "Sam", Teams: []*Team{{ID: 2}}})
+	if err != nil {
+		t.Fatal("failed to insert with associations", err)
+	}
+	var players []Player
+	if err := s.Preload("Teams").OrderBy("ID").Find(&players); err != nil {
+		t.Fatal("failed to preload many to many in batches", err)
+	}
+	if len(players) != 2 || len(players[0].Teams) != 2 || len(players[1].Teams) != 1 || players[1].Teams[0].Name != "blue" {
+		t.Fatal("failed to merge the batches of many to many, got", players)
+	}
+}
+
+func TestSession_Joins(t *testing.T) {
+	s := testAssociationInit(t)
+	var buyers []Buyer
+	if err := s.Joins("Profile").OrderBy("Buyer.ID").Find(&buyers); err != nil {
+		t.Fatal("failed to join", err)
+	}
+	if len(buyers) != 2 || buyers[0].Profile == nil || buyers[0].Profile.Level != "gold" || buyers[1].Profile != nil {
+		t.Fatal("failed to join belongs to, got", buyers)
+	}
+	b := &Buyer{}
+	if err := s.Joins("Profile").Where("Profile.Level = ?", "gold").First(b); err != nil || b.Name != "Tom" {
+		t.Fatal("failed to query by joined columns, got", b, err)
+	}
+}
+
+type Player struct {
+	ID    int `orm:"pk"`
+	Name  string
+	Teams []*Team `orm:"many2many:player_teams"`
+}
+
+type Team struct {
+	ID      int `orm:"pk"`
+	Name    string
+	Players []Player `orm:"many2many:player_teams"`
+}
+
+func testMany2ManyInit(t *testing.T) *Session {
+	t.Helper()
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d)
+	_, _ = s.Raw("DROP TABLE IF EXISTS player_teams").Exec()
+	for _, model := range []any{&Player{}, &Team{}} {
+		_ = s.Model(model).DropTable()
+		if err := s.Model(model).CreateTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s.Debug()
+}
+
+func TestSession_Many2Many(t *testing.T) {
+	s := testMany2ManyInit(t)
+	joinTable := s.Model(&Player{}).RefTable().Relationship("Teams").JoinTable()
+	if !s.withTable(joinTable).HasTable() || len(joinTable.Fields) != 2 {
+		t.Fatal("failed to create join table")
+	}
+	tom := &Player{ID: 1, Name: "Tom", Teams: []*Team{{ID: 1, Name: "red"}, {ID: 2, Name: "blue"}}}
+	if _, err := s.WithAssociations().Insert(tom, &Player{ID: 2, Name: "Sam"}); err != nil {
+		t.Fatal("failed to insert with associations", err)
+	}
+	sam := &Player{ID: 2}
+	association := s.Association(sam, "Teams")
+	if err := association.Append(&Team{ID: 2, Name: "ignored"}, Team{ID: 3, Name: "green"}); err != nil {
+		t.Fatal("failed to append", err)
+	}
+	// appending twice keeps a single link
+	if err := association.Append(Team{ID: 3}); err != nil || len(sam.Teams) != 2 {
+		t.Fatal("failed to append again", err, sam.Teams)
+	}
+	if count, err := association.Count(); err != nil || count != 2 {
+		t.Fatal("failed to count associations", count, err)
+	}
+	if dry := s.Clone().DryRun(); len(dry.Statements()) != 0 {
+		t.Fatal("expect a new dry run to hold no statements")
+	} else if count, err := dry.Association(sam, "Teams").Count(); err != nil || count != 0 || len(dry.Statements()) != 1 {
+		t.Fatal("failed to record the count of associations on a dry run", count, err)
+	}
+
+	var teams []Team
+	if err := s.Preload("Players").OrderBy("ID").Find(&teams); err != nil {
+		t.Fatal("failed to preload many to many", err)
+	}
+	if len(teams) != 3 || teams[1].Name != "blue" || len(teams[0].Players) != 1 || len(teams[1].Players) != 2 || len(teams[2].Players) != 1 {
+		t.Fatal("failed to preload many to many, got", teams)
+	}
+
+	if err := association.Delete(Team{ID: 2}); err != nil || len(sam.Teams) != 1 || sam.Teams[0].ID != 3 {
+		t.Fatal("failed to delete association", err, sam.Teams)
+	}
+	if err := s.Association(tom, "Teams").Replace(Team{ID: 3}); err != nil || len(tom.Teams) != 1 {
+		t.Fatal("failed to replace associations", err)
+	}
+	var players []Player
+	if err := s.Preload("Teams").OrderBy("ID").Find(&players); err != nil {
+		t.Fatal("failed to preload many to many", err)
+	}
+	if len(players[0].Teams) != 1 || players[0].Teams[0].Name != "green" || len(players[1].Teams) != 1 {
+		t.Fatal("failed to maintain associations, got", players[0].Teams, players[1].Teams)
+	}
+	if count, _ := s.Model(&Team{}).Count(); count != 3 {
+		t.Fatal("associated records should be kept, got", count)
+	}
+	// existing records are linked as they are
+	if err := s.Association(tom, "Teams").Append(&Team{ID: 1, Name: "renamed"}); err != nil {
+		t.Fatal("failed to append an existing record", err)
+	}
+	if team := (&Team{}); s.Where("ID = ?", 1).First(team) != nil || team.Name != "red" {
+		t.Fatal("expect an appended existing record to be kept, got", team)
+	}
+	if err := s.Association(tom, "Teams").Append(&Team{Name: "new"}); err == nil || !strings.Contains(err.Error(), "generated keys") {
+		t.Fatal("expect an error appending a record without a primary key, got", err)
+	}
+	if err := s.Association(tom, "Name").Append(); err == nil {
+		t.Fatal("expect an error for a field which isn't an association")
+	}
+}
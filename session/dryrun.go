@@ -0,0 +1,108 @@
+package session
+
+import (
+	"database/sql/driver"
+	"github.com/go-needle/orm/dialect"
+	"strings"
+	"sync"
+)
+
+// Statement is a statement recorded instead of executed by a dry run session
+type Statement struct {
+	SQL  string
+	Vars []any
+	// Interpolated is SQL with Vars written as literals of the dialect, for logs
+	Interpolated string
+}
+
+// String returns the SQL of the statement terminated by a semicolon
+func (st Statement) String() string {
+	sql := strings.TrimSpace(st.SQL)
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+	return sql
+}
+
+// recorder collects the statements of a dry run, it is shared by the copies of a session
+type recorder struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+func (r *recorder) record(statement Statement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, statement)
+}
+
+// record records the statement query with bind vars vars, written with ? placeholders
+func (s *Session) record(query string, vars []any) {
+	s.recorder.record(Statement{
+		SQL:          dialect.Rebind(s.dialect, query),
+		Vars:         append([]any(nil), vars...),
+		Interpolated: strings.TrimSpace(dialect.Interpolate(s.dialect, query, vars)),
+	})
+}
+
+// DryRun makes the session record the statements it would execute instead of executing them,
+// they are returned by Statements:
+//   - statements run by Exec, e.g. by Insert, Update, Delete and migrations, are recorded
+//     and affect no rows;
+//   - queries of records, by Find, First, Count, Each and Association.Count, are recorded
+//     and find nothing, after running their hooks;
+//   - other queries still run: those of Raw(...).QueryRow and QueryRows, and those reading
+//     the schema, like HasTable and Plan, so that statements are generated from the actual
+//     state of the database, e.g. whether a table exists.
+func (s *Session) DryRun() *Session {
+	s = s.getInstance()
+	s.recorder = &recorder{}
+	return s
+}
+
+// recordQuery records the query of records sql in place of running it on a dry run session,
+// and reports whether it did, see DryRun
+func (s *Session) recordQuery(sql string, vars []any) (bool, error) {
+	if s.recorder == nil {
+		return false, nil
+	}
+	_, err := s.raw(sql, vars...).Exec()
+	return true, err
+}
+
+// Statements returns the statements recorded by a dry run session
+func (s *Session) Statements() []Statement {
+	if s.recorder == nil {
+		return nil
+	}
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	return append([]Statement(nil), s.recorder.statements...)
+}
+
+// ToSQL returns the statements f builds on a dry run copy of s, interpolated for logs, e.g.
+//
+//	sql := s.ToSQL(func(tx *Session) *Session {
+//		_ = tx.Model(&User{}).Where("Age > ?", 18).Find(&users)
+//		return tx
+//	})
+//
+// Several statements are separated by semicolons and new lines.
+func (s *Session) ToSQL(f func(*Session) *Session) string {
+	dry := s.Clone()
+	dry.recorder = &recorder{}
+	f(dry)
+	var statements []string
+	for _, statement := range dry.Statements() {
+		statements = append(statements, strings.TrimSuffix(statement.Interpolated, ";"))
+	}
+	return strings.Join(statements, ";\n")
+}
+
+// dryRunResult is the result of a statement recorded by a dry run
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 0, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 0, nil }
+
+var _ driver.Result = dryRunResult{}
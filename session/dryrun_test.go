@@ -0,0 +1,101 @@
+package session
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/dialect"
+	"testing"
+)
+
+func TestSession_DryRun(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Model(&Login{})
+	_ = s.DropTable()
+	dry := s.DryRun()
+	if err := dry.CreateTable(); err != nil {
+		t.Fatal("failed to dry run", err)
+	}
+	if s.HasTable() {
+		t.Fatal("a dry run shouldn't execute statements")
+	}
+	if _, err := dry.Insert(&Login{ID: 1, Email: "a@b.c"}); err != nil {
+		t.Fatal("failed to dry run insert", err)
+	}
+	statements := dry.Statements()
+	if len(statements) != 4 || statements[1].String() != "CREATE UNIQUE INDEX idx_login_email ON Login (Email);" {
+		t.Fatal("failed to record statements, got", statements)
+	}
+	if insert := statements[3]; insert.String() != "INSERT INTO Login (ID,Email,Age,CrewID) VALUES (?, ?, ?, ?);" || len(insert.Vars) != 4 {
+		t.Fatal("failed to record insert, got", insert)
+	}
+}
+
+func TestSession_DryRunQuery(t *testing.T) {
+	db, err := sql.Open("sqlite3", "g.db")
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer func() { _ = db.Close() }()
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Model(&Login{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Login{ID: 1, Email: "a@b.c", Age: 20})
+	dry := s.DryRun()
+	var logins []Login
+	if err := dry.Where("Age > ?", 18).Find(&logins); err != nil || len(logins) != 0 {
+		t.Fatal("failed to dry run find", err, logins)
+	}
+	var login Login
+	if err := dry.Where("Email = ?", "a@b.c").First(&login); err != nil || login.ID != 0 {
+		t.Fatal("failed to dry run first", err, login)
+	}
+	if count, err := dry.Count(); err != nil || count != 0 {
+		t.Fatal("failed to dry run count", err, count)
+	}
+	statements := dry.Statements()
+	if len(statements) != 3 || statements[1].Interpolated != "SELECT ID, Email, Age, CrewID FROM Login WHERE Email = 'a@b.c' LIMIT 1" {
+		t.Fatal("failed to record queries, got", statements)
+	}
+}
+
+func TestSession_ToSQL(t *testing.T) {
+	db, err := sql.Open("sqlite3", "g.db")
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer func() { _ = db.Close() }()
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Model(&Login{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	query := s.ToSQL(func(tx *Session) *Session {
+		var logins []Login
+		_ = tx.Where("Age > ? AND Email LIKE ?", 18, "%'s").Find(&logins)
+		return tx
+	})
+	if query != "SELECT ID, Email, Age, CrewID FROM Login WHERE Age > 18 AND Email LIKE '%''s'" {
+		t.Fatal("failed to build sql, got", query)
+	}
+	query = s.ToSQL(func(tx *Session) *Session {
+		_, _ = tx.Insert(&Login{ID: 2, Email: "b@c.d"})
+		_, _ = tx.Where("ID = ?", 2).Delete()
+		return tx
+	})
+	if query != "INSERT INTO Login (ID,Email,Age,CrewID) VALUES (2, 'b@c.d', 0, 0);\nDELETE FROM Login WHERE ID = 2" {
+		t.Fatal("failed to build sql, got", query)
+	}
+	// columns are set in order whatever the order of the map
+	for i := 0; i < 10; i++ {
+		query = s.ToSQL(func(tx *Session) *Session {
+			_, _ = tx.Where("ID = ?", 2).Update(map[string]any{"Email": "c@d.e", "Age": 3, "CrewID": 1})
+			return tx
+		})
+		if query != "UPDATE Login SET Age = 3, CrewID = 1, Email = 'c@d.e' WHERE ID = 2" {
+			t.Fatal("failed to build update in order, got", query)
+		}
+	}
+	if count, _ := s.Count(); count != 0 {
+		t.Fatal("ToSQL shouldn't execute statements")
+	}
+}
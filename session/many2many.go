@@ -0,0 +1,372 @@
+package session
+
+import (
+	"fmt"
+	"github.com/go-needle/orm/clause"
+	"github.com/go-needle/orm/schema"
+	"reflect"
+)
+
+// Association maintains the links of a many to many relationship of a record,
+// the associated records passed in are inserted first unless they exist.
+// Existing records are linked as they are, their columns aren't updated, use Update for that.
+type Association struct {
+	session *Session
+	owner   reflect.Value
+	rel     *schema.Relationship
+	// Error is set when the association can't be used, it is returned by every method
+	Error error
+}
+
+// Association returns the association name of value, which must be a pointer to a record with a primary key
+func (s *Session) Association(value any, name string) *Association {
+	a := &Association{session: s}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		a.Error = fmt.Errorf("can't use association %s: %T should be a pointer to struct", name, value)
+		return a
+	}
+	a.owner = v.Elem()
+	table := schema.ParseWithNamer(value, s.dialect, s.namer)
+	if a.rel = table.Relationship(name); a.rel == nil {
+		a.Error = fmt.Errorf("can't use association %s: %s has no relationship %s", name, table.Name, name)
+	} else if a.rel.Type != schema.ManyToMany {
+		a.Error = fmt.Errorf("can't use association %s: only many to many relationships are supported", name)
+	} else if _, _, err := a.rel.JoinFields(); err != nil {
+		a.Error = err
+	}
+	return a
+}
+
+// Append links values, records or pointers to records, to the owner and appends them to its field,
+// unless the field already holds a record of the same primary key.
+// The values must have their primary key set, generated keys aren't read back, and
+// those of existing records are linked without being updated.
+func (a *Association) Append(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	err := a.session.transaction(func(tx *Session) error {
+		return tx.appendAssociation(a.owner, a.rel, values)
+	})
+	if err != nil {
+		return err
+	}
+	relatedField := a.rel.RelatedField()
+	field := a.rel.Settable(a.owner)
+	held := make(map[string]bool)
+	for i := 0; i < field.Len(); i++ {
+		if key, ok := joinKey(relatedField.ValueOf(reflect.Indirect(field.Index(i)))); ok {
+			held[key] = true
+		}
+	}
+	for _, value := range values {
+		if key, ok := joinKey(relatedField.ValueOf(reflect.Indirect(reflect.ValueOf(value)))); ok {
+			if held[key] {
+				continue
+			}
+			held[key] = true
+		}
+		field.Set(reflect.Append(field, associatedValue(field.Type().Elem(), value)))
+	}
+	return nil
+}
+
+// Replace links values to the owner in place of the current associations,
+// they are inserted or linked as by Append
+func (a *Association) Replace(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	err := a.session.transaction(func(tx *Session) error {
+		if err := tx.appendAssociation(a.owner, a.rel, values); err != nil {
+			return err
+		}
+		_, err := tx.unlinkAssociation(a.owner, a.rel, values, true)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	field := a.rel.Settable(a.owner)
+	slice := reflect.MakeSlice(field.Type(), 0, len(values))
+	for _, value := range values {
+		slice = reflect.Append(slice, associatedValue(field.Type().Elem(), value))
+	}
+	field.Set(slice)
+	return nil
+}
+
+// Delete unlinks values from the owner and removes them from its field, the records are kept
+func (a *Association) Delete(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if _, err := a.session.unlinkAssociation(a.owner, a.rel, values, false); err != nil {
+		return err
+	}
+	relatedField := a.rel.RelatedField()
+	deleted := make(map[string]bool)
+	for _, value := range values {
+		if key, ok := joinKey(relatedField.ValueOf(reflect.Indirect(reflect.ValueOf(value)))); ok {
+			deleted[key] = true
+		}
+	}
+	field := a.rel.Settable(a.owner)
+	slice := reflect.MakeSlice(field.Type(), 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		if key, ok := joinKey(relatedField.ValueOf(reflect.Indirect(field.Index(i)))); !ok || !deleted[key] {
+			slice = reflect.Append(slice, field.Index(i))
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+// Count returns the number of records linked to the owner
+func (a *Association) Count() (int64, error) {
+	if a.Error != nil {
+		return 0, a.Error
+	}
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return 0, err
+	}
+	joinTable, related := a.rel.JoinTable(), a.rel.Schema()
+	joinOwner, joinRelated := joinTable.GetField(a.rel.ForeignKey), joinTable.GetField(a.rel.References)
+	s := a.session.newSession()
+	s.clause.Set(clause.COUNT, fmt.Sprintf("%s JOIN %s ON %s.%s = %s.%s", related.Name, joinTable.Name,
+		joinTable.Name, joinRelated.MappingName, related.Name, related.PrimaryField.MappingName))
+	s.clause.Set(clause.WHERE, joinTable.Name+"."+joinOwner.MappingName+" = ?", ownerKey)
+	s.scopeSoftDelete(related)
+	sql, vars := s.clause.Build(clause.COUNT, clause.WHERE)
+	if recorded, err := s.recordQuery(sql, vars); recorded {
+		return 0, err
+	}
+	var count int64
+	if err := s.raw(sql, vars...).QueryRow().Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (a *Association) ownerKey() (any, error) {
+	return primaryKey(a.rel.OwnerField(), a.owner)
+}
+
+// primaryKey returns the value of the primary key of record dest, failing when it's zero
+func primaryKey(field *schema.Field, dest reflect.Value) (any, error) {
+	v := field.ValueOf(dest)
+	if !v.IsValid() || v.IsZero() {
+		return nil, fmt.Errorf("%s has no primary key %s", dest.Type().Name(), field.Name)
+	}
+	return field.DBValue(v)
+}
+
+// associatedValue converts value, a record or a pointer to record, to typ, the element type of the association
+func associatedValue(typ reflect.Type, value any) reflect.Value {
+	v := reflect.ValueOf(value)
+	if typ.Kind() == reflect.Pointer && v.Kind() != reflect.Pointer {
+		return addressable(value).Addr()
+	}
+	if typ.Kind() != reflect.Pointer && v.Kind() == reflect.Pointer {
+		return v.Elem()
+	}
+	return v
+}
+
+// appendAssociation inserts the records of values which don't exist yet, and links them to owner
+func (s *Session) appendAssociation(owner reflect.Value, rel *schema.Relationship, values []any) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ownerKey, err := primaryKey(rel.OwnerField(), owner)
+	if err != nil {
+		return err
+	}
+	related, joinTable := rel.Schema(), rel.JoinTable()
+	var links []any
+	for _, value := range values {
+		relatedKey, err := primaryKey(related.PrimaryField, reflect.Indirect(reflect.ValueOf(value)))
+		if err != nil {
+			// the key of a new record would be generated by the database, and couldn't be linked
+			return fmt.Errorf("can't link %s to %s: %w, generated keys aren't supported", rel.Name, owner.Type().Name(), err)
+		}
+		links = append(links, []any{ownerKey, relatedKey})
+	}
+	// existing records are kept as they are
+	_, err = s.newSession().Clauses(clause.OnConflict{Columns: []string{related.PrimaryField.MappingName}, DoNothing: true}).
+		Insert(values...)
+	if err != nil {
+		return err
+	}
+	q := s.newSession().withTable(joinTable).Clauses(clause.OnConflict{Columns: joinTable.MappingFieldNames, DoNothing: true})
+	q.clause.Set(clause.INSERT, joinTable.Name, []string{
+		joinTable.GetField(rel.ForeignKey).MappingName, joinTable.GetField(rel.References).MappingName,
+	})
+	q.clause.Set(clause.VALUES, links...)
+	sql, vars := q.clause.Build(clause.INSERT, clause.VALUES, clause.ONCONFLICT)
+	_, err = q.raw(sql, vars...).Exec()
+	return err
+}
+
+// unlinkAssociation deletes the links of owner to values, or to all records but values when except is set
+func (s *Session) unlinkAssociation(owner reflect.Value, rel *schema.Relationship, values []any, except bool) (int64, error) {
+	ownerKey, err := primaryKey(rel.OwnerField(), owner)
+	if err != nil {
+		return 0, err
+	}
+	joinTable := rel.JoinTable()
+	var keys []any
+	for _, value := range values {
+		relatedKey, err := primaryKey(rel.Schema().PrimaryField, reflect.Indirect(reflect.ValueOf(value)))
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, relatedKey)
+	}
+	q := s.newSession()
+	q.clause.Set(clause.DELETE, joinTable.Name)
+	q.clause.Set(clause.WHERE, joinTable.GetField(rel.ForeignKey).MappingName+" = ?", ownerKey)
+	if len(keys) > 0 {
+		op := "IN"
+		if except {
+			op = "NOT IN"
+		}
+		q.clause.And(fmt.Sprintf("%s %s (%s)", joinTable.GetField(rel.References).MappingName, op, bindVars(len(keys))), keys...)
+	}
+	sql, vars := q.clause.Build(clause.DELETE, clause.WHERE)
+	result, err := q.raw(sql, vars...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// saveAssociations inserts and links the records held by the many to many relationships of value
+func (s *Session) saveAssociations(value any) error {
+	owner := addressable(value)
+	for _, rel := range schema.ParseWithNamer(value, s.dialect, s.namer).Relationships {
+		if rel.Type != schema.ManyToMany {
+			continue
+		}
+		if _, _, err := rel.JoinFields(); err != nil {
+			return err
+		}
+		field := rel.Settable(owner)
+		var values []any
+		for i := 0; i < field.Len(); i++ {
+			values = append(values, field.Index(i).Interface())
+		}
+		if err := s.appendAssociation(owner, rel, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadMany2Many loads the records linked to those in destSlice through the join table of rel
+func (s *Session) preloadMany2Many(destSlice reflect.Value, rel *schema.Relationship, nested []string) error {
+	ownerField, relatedField, err := rel.JoinFields()
+	if err != nil {
+		return err
+	}
+	var ownerKeys []any
+	seen := make(map[string]bool)
+	for i := 0; i < destSlice.Len(); i++ {
+		v := ownerField.ValueOf(destSlice.Index(i))
+		if key, ok := joinKey(v); ok && !seen[key] {
+			seen[key] = true
+			ownerKeys = append(ownerKeys, v.Interface())
+		}
+	}
+	if len(ownerKeys) == 0 {
+		return nil
+	}
+
+	joinTable := rel.JoinTable()
+	joinOwner, joinRelated := joinTable.GetField(rel.ForeignKey), joinTable.GetField(rel.References)
+	links := make(map[string][]string)
+	var relatedKeys []any
+	seen = make(map[string]bool)
+	for _, batch := range batches(ownerKeys) {
+		q := s.newSession().Where(fmt.Sprintf("%s IN (%s)", joinOwner.MappingName, bindVars(len(batch))), batch...)
+		q.clause.Set(clause.SELECT, joinTable.Name, []string{joinOwner.MappingName, joinRelated.MappingName})
+		sql, vars := q.clause.Build(clause.SELECT, clause.WHERE)
+		rows, err := q.raw(sql, vars...).QueryRows()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			link := reflect.New(reflect.TypeOf(joinTable.Model).Elem()).Elem()
+			if err := rows.Scan(joinOwner.ValueOf(link).Addr().Interface(), joinRelated.ValueOf(link).Addr().Interface()); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			ownerKey, _ := joinKey(joinOwner.ValueOf(link))
+			relatedKey, _ := joinKey(joinRelated.ValueOf(link))
+			links[ownerKey] = append(links[ownerKey], relatedKey)
+			if !seen[relatedKey] {
+				seen[relatedKey] = true
+				relatedKeys = append(relatedKeys, joinRelated.ValueOf(link).Interface())
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+
+	related, err := s.findIn(rel.FieldType, relatedField.MappingName, relatedKeys, nested)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]reflect.Value)
+	for i := 0; i < related.Len(); i++ {
+		item := related.Index(i)
+		if key, ok := joinKey(relatedField.ValueOf(item)); ok {
+			records[key] = item
+		}
+	}
+	for i := 0; i < destSlice.Len(); i++ {
+		owner := destSlice.Index(i)
+		key, ok := joinKey(ownerField.ValueOf(owner))
+		if !ok {
+			continue
+		}
+		var items []reflect.Value
+		for _, relatedKey := range links[key] {
+			// soft deleted records are linked but not found
+			if item, ok := records[relatedKey]; ok {
+				items = append(items, item)
+			}
+		}
+		setAssociation(rel.Settable(owner), items)
+	}
+	return nil
+}
+
+// transaction runs f in the transaction of s, or in a new one committed when f succeeds
+func (s *Session) transaction(f func(tx *Session) error) (err error) {
+	if s.tx != nil {
+		return f(s)
+	}
+	tx := s.Clone()
+	tx.immutable = false
+	if err := tx.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	return f(tx)
+}
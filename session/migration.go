@@ -0,0 +1,232 @@
+package session
+
+import (
+	"fmt"
+	"github.com/go-needle/orm/dialect"
+	"github.com/go-needle/orm/schema"
+	"strings"
+)
+
+// Introspect returns the schema of the table name in the database, nil if it doesn't exist
+func (s *Session) Introspect(name string) (*schema.Schema, error) {
+	introspector, err := dialect.IntrospectorOf(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := introspector.ColumnsOf(s.DB(), name)
+	if err != nil || len(columns) == 0 {
+		return nil, err
+	}
+	indexes, err := introspector.IndexesOf(s.DB(), name)
+	if err != nil {
+		return nil, err
+	}
+	return schema.FromTable(name, columns, indexes), nil
+}
+
+// Plan returns the changes turning the table of the model in the database into the table of the model
+func (s *Session) Plan() (*schema.Plan, error) {
+	s = s.fork()
+	table := s.RefTable()
+	live, err := s.Introspect(table.Name)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Diff(table, live)
+}
+
+// JoinTablePlans returns the plans of the join tables of the many to many relationships of the model
+func (s *Session) JoinTablePlans() ([]*schema.Plan, error) {
+	s = s.fork()
+	var plans []*schema.Plan
+	for _, rel := range s.RefTable().Relationships {
+		if rel.Type != schema.ManyToMany {
+			continue
+		}
+		if _, _, err := rel.JoinFields(); err != nil {
+			return nil, err
+		}
+		joinTable := rel.JoinTable()
+		live, err := s.Introspect(joinTable.Name)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := schema.Diff(joinTable, live)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// Apply executes plan, the table is rebuilt when the dialect can't alter or drop its columns in place.
+// Join tables are planned on their own, see CreateJoinTables.
+func (s *Session) Apply(plan *schema.Plan) error {
+	s = s.fork()
+	table := plan.Model
+	if plan.Has(schema.CreateTable) {
+		if err := s.createTable(table, table.Name); err != nil {
+			return err
+		}
+		return s.createIndexes(table)
+	}
+	var statements []string
+	rebuild := false
+	for _, change := range plan.Changes {
+		switch change.Kind {
+		case schema.AlterColumn:
+			alter := dialect.AlterColumnSQL(s.dialect, table.Name, columnInfo(change.Field))
+			rebuild = rebuild || alter == nil
+			statements = append(statements, alter...)
+		case schema.DropColumn:
+			drop := dialect.DropColumnSQL(s.dialect, table.Name, change.Live.MappingName)
+			rebuild = rebuild || drop == ""
+			statements = append(statements, drop)
+		}
+	}
+	if rebuild {
+		return s.rebuildTable(plan)
+	}
+
+	for _, change := range plan.Changes {
+		if change.Kind == schema.RenameColumn {
+			sql := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", table.Name, change.Live.MappingName, change.Field.MappingName)
+			if _, err := s.raw(sql).Exec(); err != nil {
+				return err
+			}
+		}
+	}
+	// indexes go first as they may cover dropped columns
+	for _, change := range plan.Changes {
+		if change.Kind == schema.DropIndex {
+			if _, err := s.raw(dialect.DropIndexSQL(s.dialect, table.Name, change.Index.Name)).Exec(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, change := range plan.Changes {
+		if change.Kind == schema.AddColumn {
+			sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table.Name, columnDefinition(change.Field, false))
+			if _, err := s.raw(sql).Exec(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sql := range statements {
+		if _, err := s.raw(sql).Exec(); err != nil {
+			return err
+		}
+	}
+	for _, change := range plan.Changes {
+		if change.Kind == schema.AddIndex {
+			if err := s.createIndex(table, change.Index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildTable recreates the table of plan with the DDL of the model, keeping the data of the
+// columns the model shares with the live table, following the steps SQLite documents for schema
+// changes it can't make with ALTER TABLE. Foreign keys must be off, see Engine.Migrate, a dry run
+// turns them off around the rebuild and checks them after it.
+func (s *Session) rebuildTable(plan *schema.Plan) error {
+	table := plan.Model
+	sources := make(map[*schema.Field]string)
+	for _, change := range plan.Changes {
+		switch change.Kind {
+		case schema.AddColumn:
+			sources[change.Field] = ""
+		case schema.RenameColumn:
+			sources[change.Field] = change.Live.MappingName
+		}
+	}
+	var columns, selected []string
+	for _, field := range table.Fields {
+		source, ok := sources[field]
+		if !ok {
+			source = field.MappingName
+		}
+		if source != "" {
+			columns = append(columns, field.MappingName)
+			selected = append(selected, source)
+		}
+	}
+	// triggers are dropped with the table, and views referring to it would break the rename
+	var dependents []dialect.Dependent
+	var checks []string
+	if rebuilder, ok := s.dialect.(dialect.Rebuilder); ok {
+		// dropping the table would delete the rows referring to it on cascade
+		if s.recorder != nil {
+			// the statements of a dry run are run elsewhere, they turn foreign keys off themselves,
+			// which works outside a transaction only
+			if _, err := s.raw(rebuilder.ForeignKeysSQL(false) + ";").Exec(); err != nil {
+				return err
+			}
+			checks = []string{rebuilder.ForeignKeyCheckSQL() + ";", rebuilder.ForeignKeysSQL(true) + ";"}
+		} else {
+			var enabled bool
+			if err := s.raw(rebuilder.ForeignKeysEnabledSQL()).QueryRow().Scan(&enabled); err != nil {
+				return err
+			}
+			if enabled {
+				return fmt.Errorf("can't rebuild table %s while foreign keys are enforced, "+
+					"turn them off before the transaction as Engine.Migrate does", table.Name)
+			}
+		}
+		var err error
+		if dependents, err = rebuilder.DependentsOf(s.DB(), table.Name); err != nil {
+			return err
+		}
+	}
+
+	tmp := "new_" + table.Name
+	if err := s.createTable(table, tmp); err != nil {
+		return err
+	}
+	statements := []string{
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", tmp, strings.Join(columns, ", "), strings.Join(selected, ", "), table.Name),
+	}
+	for _, dependent := range dependents {
+		if dependent.Type == "view" {
+			statements = append(statements, fmt.Sprintf("DROP VIEW %s;", dependent.Name))
+		}
+	}
+	statements = append(statements,
+		fmt.Sprintf("DROP TABLE %s;", table.Name),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tmp, table.Name),
+	)
+	for _, sql := range statements {
+		if _, err := s.raw(sql).Exec(); err != nil {
+			return err
+		}
+	}
+	// the indexes were dropped with the old table
+	if err := s.createIndexes(table); err != nil {
+		return err
+	}
+	for _, dependent := range dependents {
+		if _, err := s.raw(dependent.SQL + ";").Exec(); err != nil {
+			return fmt.Errorf("failed to recreate %s %s after rebuilding %s: %w", dependent.Type, dependent.Name, table.Name, err)
+		}
+	}
+	for _, sql := range checks {
+		if _, err := s.raw(sql).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnInfo returns the column of field as the dialect describes it
+func columnInfo(field *schema.Field) dialect.ColumnInfo {
+	return dialect.ColumnInfo{
+		Name:       field.MappingName,
+		Type:       field.Type,
+		NotNull:    field.NotNull,
+		PrimaryKey: field.PrimaryKey,
+		Default:    field.Default,
+	}
+}
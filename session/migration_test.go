@@ -0,0 +1,55 @@
+package session
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/dialect"
+	"github.com/go-needle/orm/schema"
+	"testing"
+)
+
+type Invoice struct {
+	ID     int    `orm:"pk"`
+	Number string `orm:"notNull;uniqueIndex:idx_invoice_number"`
+	Amount float64
+	Paid   bool `orm:"default:0"`
+}
+
+func TestSession_Plan(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Debug().Model(&Invoice{})
+	_ = s.DropTable()
+	if plan, err := s.Plan(); err != nil || !plan.Has(schema.CreateTable) {
+		t.Fatal("expect a create table plan", plan, err)
+	}
+	_, _ = s.Raw("CREATE TABLE Invoice (ID integer PRIMARY KEY, Number integer, Amount real, Note text);").Exec()
+	_, _ = s.Raw("CREATE INDEX idx_invoice_note ON Invoice (Note);").Exec()
+	_, _ = s.Raw("INSERT INTO Invoice (ID, Number, Amount, Note) VALUES (1, 1001, 9.5, 'x');").Exec()
+
+	live, err := s.Introspect("Invoice")
+	if err != nil || len(live.Fields) != 4 || !live.GetField("ID").PrimaryKey || len(live.Indexes) != 1 {
+		t.Fatal("failed to introspect table", err)
+	}
+	plan, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[schema.ChangeKind]int)
+	for _, change := range plan.Changes {
+		kinds[change.Kind]++
+	}
+	if kinds[schema.AlterColumn] != 1 || kinds[schema.AddColumn] != 1 || kinds[schema.DropColumn] != 1 ||
+		kinds[schema.DropIndex] != 1 || kinds[schema.AddIndex] != 1 {
+		t.Fatal("failed to plan changes, got\n", plan)
+	}
+	if err := s.Apply(plan); err != nil {
+		t.Fatal("failed to apply plan", err)
+	}
+	if plan, err = s.Plan(); err != nil || !plan.Empty() {
+		t.Fatal("table should be up to date, got\n", plan, err)
+	}
+	invoice := &Invoice{}
+	if err := s.First(invoice); err != nil || invoice.Number != "1001" || invoice.Amount != 9.5 {
+		t.Fatal("failed to keep data, got", invoice, err)
+	}
+}
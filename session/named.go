@@ -0,0 +1,183 @@
+package session
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/go-needle/orm/schema"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// namedArgs are the sources of the values of named parameters, looked up in order
+type namedArgs struct {
+	session *Session
+	sources []reflect.Value
+	named   map[string]any
+}
+
+// bindNamed rewrites the @name and :name parameters of query to ?, bound to the named arguments
+// among vars: sql.Named values, maps with string keys, and structs, whose fields are looked up by
+// Go or column name. The other vars are bound to the ? of query in order. A slice bound to a named
+// parameter is expanded to a list, e.g. IN (@ids), an empty one is an error since no list
+// is right for both IN and NOT IN. Without named arguments, query is left as it is.
+// Only statements of Raw are bound, see statement.
+func (s *Session) bindNamed(query string, vars []any) (string, []any, error) {
+	args := &namedArgs{session: s, named: make(map[string]any)}
+	var positional []any
+	for _, v := range vars {
+		if !args.add(v) {
+			positional = append(positional, v)
+		}
+	}
+	if len(args.sources) == 0 && len(args.named) == 0 {
+		return query, vars, nil
+	}
+
+	var sb strings.Builder
+	var bound []any
+	runes := []rune(query)
+	var quote rune
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			if len(positional) == 0 {
+				return "", nil, fmt.Errorf("too few values for the ? of %s", query)
+			}
+			bound = append(bound, positional[0])
+			positional = positional[1:]
+		case (r == '@' || r == ':') && namedParameterAt(runes, i):
+			end := i + 1
+			for end < len(runes) && isNameRune(runes, end) {
+				end++
+			}
+			name := string(runes[i+1 : end])
+			value, ok, err := args.lookup(name)
+			if err != nil {
+				return "", nil, err
+			}
+			if !ok {
+				return "", nil, fmt.Errorf("no value for the parameter %c%s of %s", r, name, query)
+			}
+			values := expand(value)
+			if len(values) == 0 {
+				// IN (NULL) would match no row, NOT IN (NULL) no row either instead of all of them
+				return "", nil, fmt.Errorf("the parameter %c%s of %s is an empty list", r, name, query)
+			}
+			sb.WriteString(bindVars(len(values)))
+			bound = append(bound, values...)
+			i = end - 1
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	if len(positional) > 0 {
+		return "", nil, fmt.Errorf("too many values for the ? of %s", query)
+	}
+	return sb.String(), bound, nil
+}
+
+// add adds v to the named arguments if it is one
+func (args *namedArgs) add(v any) bool {
+	if named, ok := v.(sql.NamedArg); ok {
+		args.named[named.Name] = named.Value
+		return true
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String {
+		args.sources = append(args.sources, value)
+		return true
+	}
+	if isValue(v) {
+		return false
+	}
+	if reflect.Indirect(value).Kind() == reflect.Struct {
+		args.sources = append(args.sources, addressable(v))
+		return true
+	}
+	return false
+}
+
+// isValue reports whether v is passed to the driver as a value, rather than holding named values
+func isValue(v any) bool {
+	switch v.(type) {
+	case nil, driver.Valuer, time.Time, *time.Time:
+		return true
+	}
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return reflect.PointerTo(typ).Implements(valuerType)
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+func (args *namedArgs) lookup(name string) (any, bool, error) {
+	if value, ok := args.named[name]; ok {
+		return value, true, nil
+	}
+	for _, source := range args.sources {
+		if source.Kind() == reflect.Map {
+			key := reflect.ValueOf(name).Convert(source.Type().Key())
+			if value := source.MapIndex(key); value.IsValid() {
+				return value.Interface(), true, nil
+			}
+			continue
+		}
+		table := schema.ParseWithNamer(source.Addr().Interface(), args.session.dialect, args.session.namer)
+		if field := table.GetField(name); field != nil {
+			v := field.ValueOf(source)
+			if !v.IsValid() {
+				// a field of a nil embedded pointer
+				return nil, true, nil
+			}
+			value, err := field.DBValue(v)
+			return value, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// expand returns the values a named parameter bound to value stands for,
+// the elements of a slice or an array, []byte aside, or value itself
+func expand(value any) []any {
+	v := reflect.ValueOf(value)
+	if isValue(value) || v.Kind() != reflect.Slice && v.Kind() != reflect.Array ||
+		v.Type().Elem().Kind() == reflect.Uint8 {
+		return []any{value}
+	}
+	values := make([]any, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+// namedParameterAt reports whether the @ or : at i starts a named parameter, it isn't part of a
+// name or of a PostgreSQL cast like id::text, and a name follows
+func namedParameterAt(runes []rune, i int) bool {
+	if i > 0 && (runes[i-1] == runes[i] || isNameRune(runes, i-1)) {
+		return false
+	}
+	return i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '_')
+}
+
+// isNameRune reports whether the rune at i belongs to a parameter name, names of fields
+// of embedded structs hold dots, e.g. @Geo.Lat
+func isNameRune(runes []rune, i int) bool {
+	r := runes[i]
+	if r == '.' {
+		return i > 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) && (unicode.IsLetter(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
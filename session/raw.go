@@ -1,23 +1,42 @@
 package session
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"github.com/go-needle/orm/clause"
 	"github.com/go-needle/orm/dialect"
 	"github.com/go-needle/orm/log"
 	"github.com/go-needle/orm/schema"
 	"strings"
+	"time"
 )
 
 type Session struct {
-	db       *sql.DB
-	tx       *sql.Tx
-	sql      strings.Builder
-	dialect  dialect.Dialect
-	clause   clause.Clause
-	refTable *schema.Schema
-	sqlVars  []any
-	isDebug  bool
+	db        *sql.DB
+	tx        *sql.Tx
+	callbacks *txCallbacks
+	ctx       context.Context
+	sql       strings.Builder
+	dialect   dialect.Dialect
+	clause    clause.Clause
+	refTable  *schema.Schema
+	namer     schema.Namer
+	nowFunc   func() time.Time
+	sqlVars   []any
+	isDebug   bool
+	unscoped  bool
+	preloads  []string
+	joins     []string
+	// withAssociations makes Insert save the many to many associations of records
+	withAssociations bool
+	// recorder collects the statements of a dry run instead of executing them
+	recorder *recorder
+	// err is the error of a chain method, it fails the next statement
+	err error
+	// named makes the statement bind named parameters, it is set by Raw
+	named     bool
+	immutable bool
 }
 
 // CommonDB is a minimal function set of db
@@ -25,6 +44,9 @@ type CommonDB interface {
 	Query(query string, args ...any) (*sql.Rows, error)
 	QueryRow(query string, args ...any) *sql.Row
 	Exec(query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
 var _ CommonDB = (*sql.DB)(nil)
@@ -37,10 +59,55 @@ func New(db *sql.DB, dialect dialect.Dialect) *Session {
 	}
 }
 
+// Clone returns a copy of the session, changes to the copy don't leak into s
+func (s *Session) Clone() *Session {
+	c := *s
+	c.sql = strings.Builder{}
+	c.sql.WriteString(s.sql.String())
+	c.sqlVars = append([]any(nil), s.sqlVars...)
+	c.preloads = append([]string(nil), s.preloads...)
+	c.joins = append([]string(nil), s.joins...)
+	return &c
+}
+
+// Session returns a copy-on-write copy of s: every chain method returns a new
+// session and leaves the receiver untouched, so a configured base query can be
+// reused and shared between goroutines.
+func (s *Session) Session() *Session {
+	c := s.Clone()
+	c.immutable = true
+	return c
+}
+
+// getInstance returns the session a chain method should modify
+func (s *Session) getInstance() *Session {
+	if s.immutable {
+		return s.Clone()
+	}
+	return s
+}
+
+// fork returns the session a statement should be built on, in copy-on-write
+// mode it is a private mutable copy so the shared base is never modified
+func (s *Session) fork() *Session {
+	if s.immutable {
+		c := s.Clone()
+		c.immutable = false
+		return c
+	}
+	return s
+}
+
 func (s *Session) Clear() {
 	s.sql.Reset()
 	s.clause.Clear()
 	s.sqlVars = nil
+	s.unscoped = false
+	s.preloads = nil
+	s.joins = nil
+	s.withAssociations = false
+	s.err = nil
+	s.named = false
 }
 
 // DB returns tx if a tx begins. otherwise return *sql.DB
@@ -51,7 +118,19 @@ func (s *Session) DB() CommonDB {
 	return s.db
 }
 
+// Raw appends sql to the statement with its values bound to ? in order. Named parameters like @name
+// and :name are bound to values which are sql.Named arguments, maps with string keys or structs,
+// whose fields are named as in the model or by their column. A slice bound to a named parameter is
+// expanded, e.g. Raw("SELECT * FROM User WHERE Age > @age AND Name IN (@names)", map[string]any{...})
 func (s *Session) Raw(sql string, values ...any) *Session {
+	s = s.raw(sql, values...)
+	s.named = true
+	return s
+}
+
+// raw appends sql built by the session to the statement, its values are bound to ? in order only
+func (s *Session) raw(sql string, values ...any) *Session {
+	s = s.getInstance()
 	s.sql.WriteString(sql)
 	s.sql.WriteString(" ")
 	s.sqlVars = append(s.sqlVars, values...)
@@ -60,46 +139,125 @@ func (s *Session) Raw(sql string, values ...any) *Session {
 
 // Exec raw sql with sqlVars
 func (s *Session) Exec() (result sql.Result, err error) {
+	s = s.fork()
 	defer s.Clear()
+	query, vars, err := s.statement()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 	if s.isDebug {
-		s.debugSql(s.sql.String(), s.sqlVars...)
+		s.debugSql(query, vars...)
+	}
+	if s.recorder != nil {
+		s.record(query, vars)
+		return dryRunResult{}, nil
 	}
-	if result, err = s.DB().Exec(s.sql.String(), s.sqlVars...); err != nil {
+	if result, err = s.DB().ExecContext(s.context(), dialect.Rebind(s.dialect, query), vars...); err != nil {
 		log.Error(err)
 	}
 	return
 }
 
-// QueryRow gets a record from db
+// QueryRow gets a record from db. A statement whose named parameters can't be bound
+// doesn't run, the error is returned by Scan.
 func (s *Session) QueryRow() *sql.Row {
+	s = s.fork()
 	defer s.Clear()
+	query, vars, err := s.statement()
+	if err != nil {
+		log.Error(err)
+		// a *sql.Row can't be built with an error, so the error is bound as a failing value:
+		// database/sql returns it while converting the values, before the statement is prepared or sent
+		return s.DB().QueryRowContext(s.context(), s.sql.String(), failedValue{err: err})
+	}
 	if s.isDebug {
-		s.debugSql(s.sql.String(), s.sqlVars...)
+		s.debugSql(query, vars...)
 	}
-	return s.DB().QueryRow(s.sql.String(), s.sqlVars...)
+	return s.DB().QueryRowContext(s.context(), dialect.Rebind(s.dialect, query), vars...)
 }
 
 // QueryRows gets a list of records from db
 func (s *Session) QueryRows() (rows *sql.Rows, err error) {
+	s = s.fork()
 	defer s.Clear()
+	query, vars, err := s.statement()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 	if s.isDebug {
-		s.debugSql(s.sql.String(), s.sqlVars...)
+		s.debugSql(query, vars...)
 	}
-	if rows, err = s.DB().Query(s.sql.String(), s.sqlVars...); err != nil {
+	if rows, err = s.DB().QueryContext(s.context(), dialect.Rebind(s.dialect, query), vars...); err != nil {
 		log.Error(err)
 	}
 	return
 }
 
+// statement returns the statement to run with its values, binding the named parameters of Raw,
+// or the error of a chain method
+func (s *Session) statement() (string, []any, error) {
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	if !s.named {
+		return s.sql.String(), s.sqlVars, nil
+	}
+	return s.bindNamed(s.sql.String(), s.sqlVars)
+}
+
+// failedValue fails the statement it is bound to with err, before the statement runs.
+// It lets QueryRow return an error in the *sql.Row it has to return, the driver never sees it.
+type failedValue struct {
+	err error
+}
+
+func (v failedValue) Value() (driver.Value, error) {
+	return nil, v.err
+}
+
+// WithNamer sets the naming strategy used to parse models
+func (s *Session) WithNamer(namer schema.Namer) *Session {
+	s = s.getInstance()
+	s.namer = namer
+	return s
+}
+
+// WithNowFunc sets the clock of auto time fields, time.Now by default
+func (s *Session) WithNowFunc(nowFunc func() time.Time) *Session {
+	s = s.getInstance()
+	s.nowFunc = nowFunc
+	return s
+}
+
+// WithContext sets the context the statements of the session run with, e.g. to cancel them
+func (s *Session) WithContext(ctx context.Context) *Session {
+	s = s.getInstance()
+	s.ctx = ctx
+	return s
+}
+
+func (s *Session) context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *Session) now() time.Time {
+	if s.nowFunc != nil {
+		return s.nowFunc()
+	}
+	return time.Now()
+}
+
 func (s *Session) Debug() *Session {
+	s = s.getInstance()
 	s.isDebug = true
 	return s
 }
 
 func (s *Session) debugSql(query string, args ...any) {
-	if len(args) == 0 {
-		log.Debug(query)
-	} else {
-		log.Debugf(strings.Replace(query, "?", "%v", len(args)), args...)
-	}
+	log.Debug(dialect.Interpolate(s.dialect, query, args))
 }
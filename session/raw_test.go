@@ -0,0 +1,112 @@
+package session
+
+import (
+	"database/sql"
+	"github.com/go-needle/orm/dialect"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSession_Clone(t *testing.T) {
+	s := testRecordInit(t).Where("Age > ?", 20)
+	c := s.Clone().Table("sys_user").Limit(1)
+	if c.RefTable().Name != "sys_user" || s.RefTable().Name != "User" {
+		t.Fatal("failed to isolate table name of clone")
+	}
+	var users []User
+	if err := s.Find(&users); err != nil || len(users) != 1 || users[0].Name != "Sam" {
+		t.Fatal("clone leaked state into its origin, got", users)
+	}
+}
+
+func TestSession_Session(t *testing.T) {
+	testRecordInit(t)
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	base := New(db, d).Model(&User{}).Session().Where("Age > ?", 20)
+	_ = base.Limit(1)
+	_ = base.OrderBy("Age DESC")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var users []User
+			if err := base.Find(&users); err != nil || len(users) != 1 {
+				t.Error("failed to reuse base query, got", users, err)
+			}
+			if n, err := base.Count(); err != nil || n != 1 {
+				t.Error("failed to reuse base query for count, got", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var users []User
+	if err := base.Where("Age < ?", 20).Find(&users); err != nil || len(users) != 1 || users[0].Name != "Tom" {
+		t.Fatal("failed to derive query from base, got", users)
+	}
+}
+
+func TestSession_RawNamed(t *testing.T) {
+	s := testRecordInit(t)
+	names := func(query string, values ...any) []string {
+		t.Helper()
+		rows, err := s.Raw(query, values...).QueryRows()
+		if err != nil {
+			t.Fatal("failed to query", query, err)
+		}
+		defer func() { _ = rows.Close() }()
+		var names []string
+		for rows.Next() {
+			var name string
+			_ = rows.Scan(&name)
+			names = append(names, name)
+		}
+		return names
+	}
+
+	got := names("SELECT user_name FROM User WHERE Age > @age AND user_name IN (@names) ORDER BY Age",
+		map[string]any{"age": 10, "names": []string{"Tom", "Sam", "Jack"}})
+	if !reflect.DeepEqual(got, []string{"Tom", "Sam"}) {
+		t.Fatal("failed to bind a map, got", got)
+	}
+	if got := names("SELECT user_name FROM User WHERE user_name = :Name", &User{Name: "Sam"}); !reflect.DeepEqual(got, []string{"Sam"}) {
+		t.Fatal("failed to bind a struct field, got", got)
+	}
+	if got := names("SELECT user_name FROM User WHERE user_name = @user_name", User{Name: "Tom"}); !reflect.DeepEqual(got, []string{"Tom"}) {
+		t.Fatal("failed to bind a struct column, got", got)
+	}
+	if got := names("SELECT user_name FROM User WHERE Age > ? AND user_name <> @name AND user_name <> '@name'", 10, sql.Named("name", "Tom")); !reflect.DeepEqual(got, []string{"Sam"}) {
+		t.Fatal("failed to bind named and positional values, got", got)
+	}
+	if _, err := s.Raw("SELECT user_name FROM User WHERE user_name NOT IN (@names)", map[string]any{"names": []string{}}).QueryRows(); err == nil ||
+		!strings.Contains(err.Error(), "empty list") {
+		t.Fatal("an empty list should fail, got", err)
+	}
+	if _, err := s.Raw("SELECT user_name FROM User WHERE user_name = @missing", map[string]any{}).QueryRows(); err == nil {
+		t.Fatal("a parameter without value should fail")
+	}
+	var name string
+	if err := s.Raw("SELECT user_name FROM User WHERE user_name = @missing", map[string]any{}).QueryRow().Scan(&name); err == nil ||
+		!strings.Contains(err.Error(), "no value for the parameter @missing") {
+		t.Fatal("a row without value for a parameter should fail to scan with the binding error, got", err)
+	}
+
+	// statements built by the session bind their values in order only
+	source := map[string]any{"name": "Tom"}
+	if query, vars, err := s.raw("SELECT @name, ?", source).statement(); err != nil || query != "SELECT @name, ? " || len(vars) != 1 {
+		t.Fatal("failed to leave the values of a statement built by the session, got", query, vars, err)
+	}
+
+	postgres, _ := dialect.GetDialect("postgres")
+	p := New(nil, postgres)
+	query, vars, err := p.bindNamed("SELECT id::text FROM t WHERE a = @a AND b IN (:b) AND c = ?", []any{3, map[string]any{"a": 1, "b": []int{2, 2}}})
+	if err != nil || dialect.Rebind(postgres, query) != "SELECT id::text FROM t WHERE a = $1 AND b IN ($2, $3) AND c = $4" ||
+		!reflect.DeepEqual(vars, []any{1, 2, 2, 3}) {
+		t.Fatal("failed to rebind named parameters, got", query, vars, err)
+	}
+}
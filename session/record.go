@@ -2,22 +2,63 @@ package session
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-needle/orm/clause"
+	"github.com/go-needle/orm/schema"
 	"reflect"
 	"strings"
 )
 
+// ErrStaleObject is returned by Update and Save when the version of the record
+// changed since it was read, i.e. another session updated it in between
+var ErrStaleObject = errors.New("stale object: the record was updated by someone else")
+
+// ErrNotFound is returned by First when no record matches
+var ErrNotFound = errors.New("NOT FOUND")
+
 func (s *Session) Insert(values ...any) (int64, error) {
+	s = s.fork()
+	if s.withAssociations {
+		s.withAssociations = false
+		var affected int64
+		err := s.transaction(func(tx *Session) (err error) {
+			if affected, err = tx.Insert(values...); err != nil {
+				return
+			}
+			for _, value := range values {
+				if err = tx.saveAssociations(value); err != nil {
+					return
+				}
+			}
+			return
+		})
+		return affected, err
+	}
 	recordValues := make([]any, 0)
 	for _, value := range values {
 		table := s.Model(value).RefTable()
 		s.clause.Set(clause.INSERT, table.Name, table.MappingFieldNames)
 		s.CallMethod(BeforeInsert, value)
-		recordValues = append(recordValues, table.RecordValues(value))
+		dest := addressable(value)
+		if err := s.setCreateTime(table, dest); err != nil {
+			return 0, err
+		}
+		// versions start at 1
+		if field := table.VersionField(); field != nil && field.ValueOf(dest).IsZero() {
+			if err := field.Set(dest, 1); err != nil {
+				return 0, err
+			}
+		}
+		record, err := table.RecordValuesErr(dest.Addr().Interface())
+		if err != nil {
+			return 0, err
+		}
+		aliveValues(table, dest, record)
+		recordValues = append(recordValues, record)
 	}
 	s.clause.Set(clause.VALUES, recordValues...)
-	sql, vars := s.clause.Build(clause.INSERT, clause.VALUES)
-	result, err := s.Raw(sql, vars...).Exec()
+	sql, vars := s.clause.Build(clause.INSERT, clause.VALUES, clause.ONCONFLICT)
+	result, err := s.raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
@@ -26,41 +67,107 @@ func (s *Session) Insert(values ...any) (int64, error) {
 }
 
 func (s *Session) Find(values any) error {
-	s.CallMethod(BeforeQuery, nil)
+	s = s.fork()
 	destSlice := reflect.Indirect(reflect.ValueOf(values))
-	destType := destSlice.Type().Elem()
+	preloads := s.preloads
+	table, err := s.query(destSlice.Type().Elem(), func(dest reflect.Value) error {
+		destSlice.Set(reflect.Append(destSlice, dest))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.preload(destSlice, table, preloads)
+}
+
+// Each scans the records found by the statement one by one into value, a pointer to struct,
+// calling f after each of them, so that they aren't held in memory at once. It stops at the
+// first error of f and returns it. Associations can't be preloaded, use Joins instead.
+func (s *Session) Each(value any, f func() error) error {
+	s = s.fork()
+	if len(s.preloads) > 0 {
+		return errors.New("can't preload associations of records scanned by Each")
+	}
+	dest := reflect.Indirect(reflect.ValueOf(value))
+	_, err := s.query(dest.Type(), func(record reflect.Value) error {
+		dest.Set(record)
+		return f()
+	})
+	return err
+}
+
+// query selects the records of model type destType matching the statement,
+// and calls f with each of them once scanned
+func (s *Session) query(destType reflect.Type, f func(dest reflect.Value) error) (*schema.Schema, error) {
+	s.CallMethod(BeforeQuery, nil)
 	table := s.Model(reflect.New(destType).Elem().Interface()).RefTable()
 
-	s.clause.Set(clause.SELECT, table.Name, table.MappingFieldNames)
-	sql, vars := s.clause.Build(clause.SELECT, clause.WHERE, clause.ORDERBY, clause.LIMIT)
-	rows, err := s.Raw(sql, vars...).QueryRows()
+	joins, err := s.joinRelationships(table)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(joins) == 0 {
+		s.clause.Set(clause.SELECT, table.Name, table.MappingFieldNames)
+		s.scopeSoftDelete(table)
+	} else {
+		s.selectJoins(table, joins)
+	}
+	sql, vars := s.clause.Build(clause.SELECT, clause.WHERE, clause.ORDERBY, clause.LIMIT, clause.LOCKING)
+	if recorded, err := s.recordQuery(sql, vars); recorded {
+		return table, err
+	}
+	rows, err := s.raw(sql, vars...).QueryRows()
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = rows.Close() }()
 
 	for rows.Next() {
 		dest := reflect.New(destType).Elem()
 		var values []any
+		var assigns []func() error
 		for _, field := range table.Fields {
-			values = append(values, dest.FieldByName(field.Name).Addr().Interface())
+			value, assign := field.ScanTarget(dest)
+			values = append(values, value)
+			assigns = append(assigns, assign)
+		}
+		for _, join := range joins {
+			joinValues, assign := join.scanTargets(dest)
+			values = append(values, joinValues...)
+			assigns = append(assigns, assign)
 		}
 		if err := rows.Scan(values...); err != nil {
-			return err
+			return nil, err
+		}
+		for _, assign := range assigns {
+			if err := assign(); err != nil {
+				return nil, err
+			}
 		}
 		s.CallMethod(AfterQuery, dest.Addr().Interface())
-		destSlice.Set(reflect.Append(destSlice, dest))
+		if err := f(dest); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return rows.Close()
+	return table, rows.Close()
 }
 
 func (s *Session) First(value any) error {
+	s = s.fork()
 	dest := reflect.Indirect(reflect.ValueOf(value))
 	destSlice := reflect.New(reflect.SliceOf(dest.Type())).Elem()
 	if err := s.Limit(1).Find(destSlice.Addr().Interface()); err != nil {
 		return err
 	}
 	if destSlice.Len() == 0 {
-		return errors.New("NOT FOUND")
+		// a dry run finds nothing
+		if s.recorder != nil {
+			return nil
+		}
+		return ErrNotFound
 	}
 	dest.Set(destSlice.Index(0))
 	return nil
@@ -69,6 +176,7 @@ func (s *Session) First(value any) error {
 // support map[string]any
 // also support kv list: "Name", "Tom", "Age", 18, ....
 func (s *Session) Update(kv ...any) (int64, error) {
+	s = s.fork()
 	s.CallMethod(BeforeUpdate, nil)
 	m, ok := kv[0].(map[string]any)
 	if !ok {
@@ -77,42 +185,139 @@ func (s *Session) Update(kv ...any) (int64, error) {
 			m[kv[i].(string)] = kv[i+1]
 		}
 	}
-	s.clause.Set(clause.UPDATE, s.RefTable().Name, m)
+	// map field names to columns and convert values as Insert does
+	table := s.RefTable()
+	values := make(map[string]any, len(m))
+	for k, v := range m {
+		if field := table.GetField(k); field != nil {
+			k = field.MappingName
+			if field.Serializer != nil {
+				var err error
+				if v, err = field.DBValue(reflect.ValueOf(v)); err != nil {
+					return 0, err
+				}
+			}
+		}
+		values[k] = v
+	}
+	now := s.now()
+	for _, field := range table.Fields {
+		if _, ok := values[field.MappingName]; !ok && field.AutoUpdateTime != 0 {
+			values[field.MappingName] = field.AutoUpdateTime.Value(now)
+		}
+	}
+	// a given version is the one expected in the database, otherwise it's just incremented
+	checkVersion := false
+	if field := table.VersionField(); field != nil {
+		if expected, ok := values[field.MappingName]; ok {
+			next, err := nextVersion(reflect.ValueOf(expected))
+			if err != nil {
+				return 0, err
+			}
+			values[field.MappingName] = next
+			s.clause.And(field.MappingName+" = ?", expected)
+			checkVersion = true
+		} else {
+			values[field.MappingName] = clause.Expr{SQL: field.MappingName + " + 1"}
+		}
+	}
+	s.clause.Set(clause.UPDATE, table.Name, values)
+	s.scopeSoftDelete(table)
 	sql, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
-	result, err := s.Raw(sql, vars...).Exec()
+	result, err := s.raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
+	affected, err := result.RowsAffected()
+	// a dry run affects no rows
+	if err == nil && checkVersion && affected == 0 && s.recorder == nil {
+		return 0, ErrStaleObject
+	}
 	s.CallMethod(AfterUpdate, nil)
-	return result.RowsAffected()
+	return affected, err
 }
 
 func (s *Session) Save(value any) (int64, error) {
+	s = s.fork()
 	s.CallMethod(BeforeUpdate, value)
 	m := make(map[string]any)
-	modelValue := reflect.Indirect(reflect.ValueOf(value))
-	modelType := modelValue.Type()
-	for i := 0; i < modelValue.NumField(); i++ {
-		if !modelValue.Field(i).IsZero() {
-			m[s.refTable.GetField(modelType.Field(i).Name).MappingName] = modelValue.Field(i).Interface()
+	modelValue := addressable(value)
+	now := s.now()
+	var version *schema.Field
+	var next any
+	for _, field := range s.Model(value).RefTable().Fields {
+		if field.AutoUpdateTime != 0 {
+			if err := field.Set(modelValue, field.AutoUpdateTime.Value(now)); err != nil {
+				return 0, err
+			}
+		}
+		if field.Version {
+			// the record must still have the version it was read with
+			current := field.ValueOf(modelValue)
+			var err error
+			if next, err = nextVersion(current); err != nil {
+				return 0, err
+			}
+			version = field
+			m[field.MappingName] = next
+			s.clause.And(field.MappingName+" = ?", current.Interface())
+			continue
+		}
+		if v := field.ValueOf(modelValue); v.IsValid() && !v.IsZero() {
+			value, err := field.DBValue(v)
+			if err != nil {
+				return 0, err
+			}
+			m[field.MappingName] = value
 		}
 	}
 	s.clause.Set(clause.UPDATE, s.RefTable().Name, m)
+	s.scopeSoftDelete(s.RefTable())
 	sql, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
-	result, err := s.Raw(sql, vars...).Exec()
+	result, err := s.raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
+	affected, err := result.RowsAffected()
+	if err == nil && version != nil {
+		if affected == 0 && s.recorder == nil {
+			return 0, ErrStaleObject
+		}
+		if err = version.Set(modelValue, next); err != nil {
+			return 0, err
+		}
+	}
 	s.CallMethod(AfterUpdate, nil)
-	return result.RowsAffected()
+	return affected, err
+}
+
+// nextVersion returns the version following v, a value of a version field
+func nextVersion(v reflect.Value) (any, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() + 1, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() + 1, nil
+	}
+	return nil, fmt.Errorf("invalid version %v, it should be an integer", v)
 }
 
 // Delete records with where clause
 func (s *Session) Delete() (int64, error) {
+	s = s.fork()
 	s.CallMethod(BeforeDelete, nil)
-	s.clause.Set(clause.DELETE, s.RefTable().Name)
-	sql, vars := s.clause.Build(clause.DELETE, clause.WHERE)
-	result, err := s.Raw(sql, vars...).Exec()
+	table := s.RefTable()
+	var sql string
+	var vars []any
+	if field := table.SoftDeleteField(); field != nil && !s.unscoped {
+		s.clause.Set(clause.UPDATE, table.Name, map[string]any{field.MappingName: field.DeletedValue(s.now())})
+		s.scopeSoftDelete(table)
+		sql, vars = s.clause.Build(clause.UPDATE, clause.WHERE)
+	} else {
+		s.clause.Set(clause.DELETE, table.Name)
+		sql, vars = s.clause.Build(clause.DELETE, clause.WHERE)
+	}
+	result, err := s.raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
@@ -120,11 +325,59 @@ func (s *Session) Delete() (int64, error) {
 	return result.RowsAffected()
 }
 
+// Restore undoes the soft delete of records with where clause
+func (s *Session) Restore() (int64, error) {
+	s = s.fork()
+	table := s.RefTable()
+	field := table.SoftDeleteField()
+	if field == nil {
+		return 0, fmt.Errorf("table %s has no soft delete field", table.Name)
+	}
+	s.clause.Set(clause.UPDATE, table.Name, map[string]any{field.MappingName: field.AliveValue()})
+	sql, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
+	result, err := s.raw(sql, vars...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// WithAssociations makes Insert link the records held by many to many relationships
+// in the same transaction, inserting those which don't exist yet, see Association.Append
+func (s *Session) WithAssociations() *Session {
+	s = s.getInstance()
+	s.withAssociations = true
+	return s
+}
+
+// Unscoped makes the next statement include soft deleted records, and Delete remove records for good
+func (s *Session) Unscoped() *Session {
+	s = s.getInstance()
+	s.unscoped = true
+	return s
+}
+
+// scopeSoftDelete excludes soft deleted records of table from the statement unless unscoped
+func (s *Session) scopeSoftDelete(table *schema.Schema) {
+	if s.unscoped {
+		return
+	}
+	if field := table.SoftDeleteField(); field != nil {
+		desc, vars := field.AliveCondition()
+		s.clause.And(desc, vars...)
+	}
+}
+
 // Count records with where clause
 func (s *Session) Count() (int64, error) {
+	s = s.fork()
 	s.clause.Set(clause.COUNT, s.RefTable().Name)
+	s.scopeSoftDelete(s.RefTable())
 	sql, vars := s.clause.Build(clause.COUNT, clause.WHERE)
-	row := s.Raw(sql, vars...).QueryRow()
+	if recorded, err := s.recordQuery(sql, vars); recorded {
+		return 0, err
+	}
+	row := s.raw(sql, vars...).QueryRow()
 	var tmp int64
 	if err := row.Scan(&tmp); err != nil {
 		return 0, err
@@ -134,39 +387,117 @@ func (s *Session) Count() (int64, error) {
 
 // Limit adds limit condition to clause
 func (s *Session) Limit(num int) *Session {
+	s = s.getInstance()
 	s.clause.Set(clause.LIMIT, num)
 	return s
 }
 
-// Where adds limit condition to clause
+// Where adds limit condition to clause. A struct matches the records equal to its non zero fields,
+// a field failing to serialize fails the statement.
 func (s *Session) Where(desc any, args ...any) *Session {
+	s = s.getInstance()
 	var vars []any
-	if reflect.TypeOf(desc).Kind() == reflect.String {
+	if expr, ok := desc.(clause.Expression); ok {
+		sql, exprVars := expr.Build(s.dialect)
+		vars = append(vars, sql)
+		vars = append(vars, exprVars...)
+		s.clause.Set(clause.WHERE, vars...)
+	} else if reflect.TypeOf(desc).Kind() == reflect.String {
 		vars = append(vars, desc)
 		vars = append(vars, args...)
 		s.clause.Set(clause.WHERE, vars...)
 	} else {
 		modelValue := reflect.Indirect(reflect.ValueOf(desc))
-		modelType := modelValue.Type()
-		var description strings.Builder
+		var conditions []string
 		var values []any
-		for i := 0; i < modelValue.NumField(); i++ {
-			if !modelValue.Field(i).IsZero() {
-				mappingName := s.refTable.GetField(modelType.Field(i).Name).MappingName
-				description.WriteString(mappingName)
-				description.WriteString(" = ?")
-				values = append(values, modelValue.Field(i).Interface())
+		for _, field := range schema.ParseWithNamer(desc, s.dialect, s.namer).Fields {
+			if v := field.ValueOf(modelValue); v.IsValid() && !v.IsZero() {
+				value, err := field.DBValue(v)
+				if err != nil {
+					// without the condition, the statement would match more records
+					s.err = fmt.Errorf("invalid condition on %s: %w", field.Name, err)
+					return s
+				}
+				conditions = append(conditions, field.MappingName+" = ?")
+				values = append(values, value)
 			}
 		}
-		vars = append(vars, description.String())
+		vars = append(vars, strings.Join(conditions, " AND "))
 		vars = append(vars, values...)
 		s.clause.Set(clause.WHERE, vars...)
 	}
 	return s
 }
 
+// Clauses adds clauses taking their own slot in the statement, like clause.Locking
+func (s *Session) Clauses(clauses ...clause.Interface) *Session {
+	s = s.getInstance()
+	for _, c := range clauses {
+		sql, vars := c.Build(s.dialect)
+		s.clause.Set(c.Type(), append([]any{sql}, vars...)...)
+	}
+	return s
+}
+
+// ForUpdate locks the rows selected by Find and First for update until the transaction ends
+func (s *Session) ForUpdate() *Session {
+	return s.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// ForShare locks the rows selected by Find and First against updates until the transaction ends
+func (s *Session) ForShare() *Session {
+	return s.Clauses(clause.Locking{Strength: "SHARE"})
+}
+
 // OrderBy adds order by condition to clause
 func (s *Session) OrderBy(desc string) *Session {
+	s = s.getInstance()
 	s.clause.Set(clause.ORDERBY, desc)
 	return s
 }
+
+// addressable returns the struct value points to, a struct passed by value is copied
+// so that its fields can be assigned
+func addressable(value any) reflect.Value {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		return v.Elem()
+	}
+	dest := reflect.New(v.Type()).Elem()
+	dest.Set(v)
+	return dest
+}
+
+// setCreateTime fills the zero auto time fields of dest to be inserted
+// aliveValues stores the soft delete field of a new record left zero or nil as alive in record, its values,
+// e.g. NULL for a zero time.Time and 0 for a nil *int64, so that the record matches AliveCondition
+func aliveValues(table *schema.Schema, dest reflect.Value, record []any) {
+	for i, field := range table.Fields {
+		if field.SoftDelete == 0 {
+			continue
+		}
+		if v := field.ValueOf(dest); !v.IsValid() || v.IsZero() {
+			record[i] = field.AliveValue()
+		}
+	}
+}
+
+func (s *Session) setCreateTime(table *schema.Schema, dest reflect.Value) error {
+	now := s.now()
+	for _, field := range table.Fields {
+		unit := field.AutoCreateTime
+		if unit == 0 {
+			unit = field.AutoUpdateTime
+		}
+		if unit == 0 {
+			continue
+		}
+		if v := field.ValueOf(dest); v.IsValid() && !v.IsZero() {
+			continue
+		}
+		if err := field.Set(dest, unit.Value(now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,10 +2,14 @@ package session
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/go-needle/log"
+	"github.com/go-needle/orm/clause"
 	"github.com/go-needle/orm/dialect"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -49,6 +53,22 @@ func TestSession_Find(t *testing.T) {
 	fmt.Println(users)
 }
 
+func TestSession_Each(t *testing.T) {
+	s := testRecordInit(t)
+	var user User
+	var names []string
+	err := s.OrderBy("Age").Each(&user, func() error {
+		names = append(names, user.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"Tom", "Sam"}) {
+		t.Fatal("failed to scan records one by one", names, err)
+	}
+	if err := s.Preload("Orders").Each(&user, func() error { return nil }); err == nil {
+		t.Fatal("Each shouldn't preload associations")
+	}
+}
+
 func TestSession_Limit(t *testing.T) {
 	s := testRecordInit(t)
 	var users []User
@@ -88,3 +108,293 @@ func TestSession_DeleteAndCount(t *testing.T) {
 		t.Fatal("failed to delete or count")
 	}
 }
+
+type Base struct {
+	ID int `orm:"constraint:PRIMARY KEY"`
+}
+
+type Geo struct {
+	City string
+}
+
+type Shop struct {
+	Base
+	Name string
+	Geo  *Geo `orm:"embedded;prefix:geo_"`
+}
+
+func TestSession_Embedded(t *testing.T) {
+	s := testRecordInit(t).Model(&Shop{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	if _, err := s.Insert(&Shop{Base{1}, "A", &Geo{"Paris"}}, &Shop{Base{2}, "B", nil}); err != nil {
+		t.Fatal("failed to insert embedded fields", err)
+	}
+	var shops []Shop
+	if err := s.Where(Shop{Geo: &Geo{"Paris"}}).Find(&shops); err != nil || len(shops) != 1 {
+		t.Fatal("failed to query by embedded fields, got", shops)
+	}
+	if shops[0].ID != 1 || shops[0].Geo.City != "Paris" {
+		t.Fatal("failed to scan embedded fields, got", shops[0])
+	}
+}
+
+type Contact struct {
+	Name  string `orm:"constraint:PRIMARY KEY"`
+	Email *string
+	Phone sql.NullString
+	Note  string
+}
+
+func TestSession_Nullable(t *testing.T) {
+	s := testRecordInit(t).Model(&Contact{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	email := "tom@example.com"
+	if _, err := s.Insert(&Contact{Name: "Tom", Email: &email}); err != nil {
+		t.Fatal("failed to insert nullable fields", err)
+	}
+	if _, err := s.Raw("INSERT INTO Contact (Name) VALUES (?)", "Sam").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	var contacts []Contact
+	if err := s.OrderBy("Name DESC").Find(&contacts); err != nil || len(contacts) != 2 {
+		t.Fatal("failed to scan NULL columns", err)
+	}
+	if *contacts[0].Email != email || contacts[0].Phone.Valid || contacts[0].Note != "" {
+		t.Fatal("failed to scan nullable fields, got", contacts[0])
+	}
+	if contacts[1].Email != nil || contacts[1].Phone.Valid || contacts[1].Note != "" {
+		t.Fatal("failed to scan NULL into fields, got", contacts[1])
+	}
+}
+
+type Settings struct {
+	Theme string
+}
+
+type Member struct {
+	Name     string   `orm:"constraint:PRIMARY KEY"`
+	Settings Settings `orm:"serializer:json"`
+	Tags     []string `orm:"serializer:gob"`
+}
+
+func TestSession_Serializer(t *testing.T) {
+	s := testRecordInit(t).Model(&Member{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, err := s.Insert(&Member{"Tom", Settings{"dark"}, []string{"a", "b"}}, &Member{"Sam", Settings{"light"}, nil})
+	if err != nil {
+		t.Fatal("failed to insert serialized fields", err)
+	}
+	if _, err = s.Where("Name = ?", "Sam").Update("Settings", Settings{"dark"}); err != nil {
+		t.Fatal("failed to update serialized field", err)
+	}
+	var members []Member
+	if err = s.Where(clause.JSONQuery("Settings", "$.Theme").Equals("dark")).OrderBy("Name DESC").Find(&members); err != nil || len(members) != 2 {
+		t.Fatal("failed to query json field", err, members)
+	}
+	if members[0].Settings.Theme != "dark" || !reflect.DeepEqual(members[0].Tags, []string{"a", "b"}) || members[1].Tags != nil {
+		t.Fatal("failed to scan serialized fields, got", members)
+	}
+}
+
+type Widget struct {
+	Name  string         `orm:"constraint:PRIMARY KEY"`
+	Attrs map[string]any `orm:"serializer:json"`
+}
+
+func TestSession_WhereSerializeError(t *testing.T) {
+	s := testRecordInit(t).Model(&Widget{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Widget{Name: "a"}, &Widget{Name: "b"})
+	// a func can't be serialized to JSON, the condition on Attrs must not be dropped
+	broken := &Widget{Attrs: map[string]any{"f": func() {}}}
+	if _, err := s.Where(broken).Delete(); err == nil {
+		t.Fatal("failed to report the condition failing to serialize")
+	}
+	if _, err := s.Where(broken).Count(); err == nil {
+		t.Fatal("failed to report the condition failing to serialize")
+	}
+	var widgets []Widget
+	if err := s.Where(broken).Find(&widgets); err == nil {
+		t.Fatal("failed to report the condition failing to serialize")
+	}
+	if count, err := s.Count(); err != nil || count != 2 {
+		t.Fatal("failed to keep the records, got", count, err)
+	}
+}
+
+type Post struct {
+	Title     string `orm:"constraint:PRIMARY KEY"`
+	CreatedAt time.Time
+	UpdatedAt int64 `orm:"autoUpdateTime:milli"`
+	Published int64 `orm:"autoCreateTime"`
+}
+
+func TestSession_AutoTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := testRecordInit(t).WithNowFunc(func() time.Time { return now }).Model(&Post{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	post := &Post{Title: "orm"}
+	if _, err := s.Insert(post); err != nil {
+		t.Fatal("failed to insert", err)
+	}
+	if !post.CreatedAt.Equal(now) || post.UpdatedAt != now.UnixMilli() || post.Published != now.Unix() {
+		t.Fatal("failed to fill auto time fields, got", post)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := s.Where("Title = ?", "orm").Update("Title", "orm"); err != nil {
+		t.Fatal("failed to update", err)
+	}
+	p := &Post{}
+	_ = s.First(p)
+	if !p.CreatedAt.Equal(post.CreatedAt) || p.UpdatedAt != now.UnixMilli() || p.Published != post.Published {
+		t.Fatal("failed to update auto time fields, got", p)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := s.Where("Title = ?", "orm").Save(p); err != nil || p.UpdatedAt != now.UnixMilli() {
+		t.Fatal("failed to save auto time fields, got", p, err)
+	}
+}
+
+type Customer struct {
+	Name      string `orm:"constraint:PRIMARY KEY"`
+	DeletedAt *time.Time
+}
+
+type Ticket struct {
+	Title   string `orm:"constraint:PRIMARY KEY"`
+	Removed bool   `orm:"softDelete"`
+}
+
+type Voucher struct {
+	Number    string `orm:"constraint:PRIMARY KEY"`
+	DeletedAt time.Time
+}
+
+type Coupon struct {
+	Code      string `orm:"constraint:PRIMARY KEY"`
+	DeletedAt *int64
+}
+
+func TestSession_SoftDeleteInsert(t *testing.T) {
+	s := testRecordInit(t)
+	// a zero time is stored as NULL, a nil unix time as 0, as live rows
+	for _, model := range []any{&Voucher{Number: "a"}, &Coupon{Code: "a"}} {
+		m := s.Model(model)
+		_ = m.DropTable()
+		_ = m.CreateTable()
+		if _, err := m.Insert(model); err != nil {
+			t.Fatal("failed to insert", err)
+		}
+		if count, err := m.Count(); err != nil || count != 1 {
+			t.Fatalf("failed to count the inserted %T, got %d %v", model, count, err)
+		}
+		if affected, err := m.Delete(); err != nil || affected != 1 {
+			t.Fatalf("failed to delete the inserted %T, got %d %v", model, affected, err)
+		}
+	}
+	var vouchers []Voucher
+	_, _ = s.Insert(&Voucher{Number: "b"})
+	if err := s.Find(&vouchers); err != nil || len(vouchers) != 1 || vouchers[0].Number != "b" || !vouchers[0].DeletedAt.IsZero() {
+		t.Fatal("failed to find the inserted voucher, got", vouchers, err)
+	}
+	var coupons []Coupon
+	_, _ = s.Insert(&Coupon{Code: "b"})
+	if err := s.Find(&coupons); err != nil || len(coupons) != 1 || coupons[0].Code != "b" {
+		t.Fatal("failed to find the inserted coupon, got", coupons, err)
+	}
+}
+
+func TestSession_SoftDelete(t *testing.T) {
+	s := testRecordInit(t).Model(&Customer{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Customer{Name: "Tom"}, &Customer{Name: "Sam"})
+	if affected, err := s.Where("Name = ?", "Tom").Delete(); err != nil || affected != 1 {
+		t.Fatal("failed to soft delete", err)
+	}
+	var customers []Customer
+	if err := s.Find(&customers); err != nil || len(customers) != 1 || customers[0].Name != "Sam" {
+		t.Fatal("failed to exclude soft deleted records, got", customers)
+	}
+	if count, _ := s.Unscoped().Count(); count != 2 {
+		t.Fatal("failed to count unscoped records, got", count)
+	}
+	if affected, _ := s.Where("Name = ?", "Tom").Update("Name", "Jack"); affected != 0 {
+		t.Fatal("failed to exclude soft deleted records from update")
+	}
+	if affected, _ := s.Where("Name = ?", "Tom").Restore(); affected != 1 {
+		t.Fatal("failed to restore")
+	}
+	if count, _ := s.Count(); count != 2 {
+		t.Fatal("failed to count restored records, got", count)
+	}
+	_, _ = s.Unscoped().Where("Name = ?", "Tom").Delete()
+	if count, _ := s.Unscoped().Count(); count != 1 {
+		t.Fatal("failed to delete unscoped, got", count)
+	}
+
+	s = s.Model(&Ticket{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Ticket{Title: "a"}, &Ticket{Title: "b"})
+	_, _ = s.Where("Title = ?", "a").Delete()
+	if count, _ := s.Count(); count != 1 {
+		t.Fatal("failed to soft delete by flag, got", count)
+	}
+}
+
+type Stock struct {
+	Item    string `orm:"constraint:PRIMARY KEY"`
+	Amount  int
+	Version int `orm:"version"`
+}
+
+func TestSession_Version(t *testing.T) {
+	s := testRecordInit(t).Model(&Stock{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Stock{Item: "apple", Amount: 10})
+	a, b := &Stock{}, &Stock{}
+	_ = s.First(a)
+	_ = s.First(b)
+	if a.Version != 1 {
+		t.Fatal("failed to init version, got", a.Version)
+	}
+	a.Amount = 9
+	if _, err := s.Where("Item = ?", "apple").Save(a); err != nil || a.Version != 2 {
+		t.Fatal("failed to save with version", err, a)
+	}
+	b.Amount = 8
+	if _, err := s.Where("Item = ?", "apple").Save(b); !errors.Is(err, ErrStaleObject) {
+		t.Fatal("failed to detect stale object, got", err)
+	}
+	if _, err := s.Where("Item = ?", "apple").Update("Amount", 7, "Version", 1); !errors.Is(err, ErrStaleObject) {
+		t.Fatal("failed to detect stale update, got", err)
+	}
+	if _, err := s.Where("Item = ?", "apple").Update("Amount", 7); err != nil {
+		t.Fatal("failed to update", err)
+	}
+	_ = s.First(a)
+	if a.Amount != 7 || a.Version != 3 {
+		t.Fatal("failed to increment version, got", a)
+	}
+}
+
+func TestSession_ForUpdate(t *testing.T) {
+	s := testRecordInit(t)
+	if err := s.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	u := &User{}
+	if err := s.Where("user_name = ?", "Tom").ForUpdate().First(u); err != nil || u.Name != "Tom" {
+		t.Fatal("failed to query for update on sqlite3", err)
+	}
+	_ = s.Commit()
+}
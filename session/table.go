@@ -2,6 +2,7 @@ package session
 
 import (
 	"fmt"
+	"github.com/go-needle/orm/dialect"
 	"github.com/go-needle/orm/log"
 	"github.com/go-needle/orm/schema"
 	"reflect"
@@ -9,15 +10,27 @@ import (
 )
 
 func (s *Session) Model(value any) *Session {
+	s = s.getInstance()
 	// nil or different model, update refTable
-	if s.refTable == nil || reflect.TypeOf(value) != reflect.TypeOf(s.refTable.Model) {
-		s.refTable = schema.Parse(value, s.dialect)
+	if s.refTable == nil || reflect.Indirect(reflect.ValueOf(value)).Type() != reflect.TypeOf(s.refTable.Model).Elem() {
+		s.refTable = schema.ParseWithNamer(value, s.dialect, s.namer)
 	}
 	return s
 }
 
 func (s *Session) Table(name string) *Session {
-	s.RefTable().Name = name
+	s = s.getInstance()
+	// copy the schema so that sessions sharing it keep their table name
+	table := *s.RefTable()
+	table.Name = name
+	s.refTable = &table
+	return s
+}
+
+// withTable sets the table of the statement to a schema without a model of its own, like a join table
+func (s *Session) withTable(table *schema.Schema) *Session {
+	s = s.getInstance()
+	s.refTable = table
 	return s
 }
 
@@ -28,26 +41,150 @@ func (s *Session) RefTable() *schema.Schema {
 	return s.refTable
 }
 
+// CreateTable creates the table of the model, and the missing join tables of its many to many relationships
 func (s *Session) CreateTable() error {
+	s = s.fork()
 	table := s.RefTable()
+	if err := s.createTable(table, table.Name); err != nil {
+		return err
+	}
+	if err := s.createIndexes(table); err != nil {
+		return err
+	}
+	return s.CreateJoinTables()
+}
+
+// CreateJoinTables creates the missing join tables of the many to many relationships of the model
+func (s *Session) CreateJoinTables() error {
+	s = s.fork()
+	for _, rel := range s.RefTable().Relationships {
+		if rel.Type != schema.ManyToMany {
+			continue
+		}
+		if _, _, err := rel.JoinFields(); err != nil {
+			return err
+		}
+		joinTable := rel.JoinTable()
+		if s.newSession().withTable(joinTable).HasTable() {
+			continue
+		}
+		if err := s.createTable(joinTable, joinTable.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTable creates the table named name with the columns and constraints of table, but not its indexes
+func (s *Session) createTable(table *schema.Schema, name string) error {
+	var primaryKeys []string
+	for _, field := range table.Fields {
+		if field.PrimaryKey {
+			primaryKeys = append(primaryKeys, field.MappingName)
+		}
+	}
+	// a composite primary key is a table constraint
+	composite := len(primaryKeys) > 1
 	var columns []string
 	for _, field := range table.Fields {
-		columns = append(columns, fmt.Sprintf("%s %s %s", field.MappingName, field.Type, field.Constraint))
+		columns = append(columns, columnDefinition(field, !composite))
+	}
+	if composite {
+		columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, ", ")))
+	}
+	for _, fk := range table.ForeignKeys() {
+		columns = append(columns, dialect.ForeignKeySQL(s.dialect, fk.Name, fk.Field.MappingName,
+			fk.References.Name, fk.ReferencedField.MappingName, fk.OnDelete, fk.OnUpdate))
 	}
 	desc := strings.Join(columns, ",")
-	_, err := s.Raw(fmt.Sprintf("CREATE TABLE %s (%s);", table.Name, desc)).Exec()
+	_, err := s.raw(fmt.Sprintf("CREATE TABLE %s (%s);", name, desc)).Exec()
+	return err
+}
+
+func (s *Session) createIndexes(table *schema.Schema) error {
+	for _, index := range table.Indexes {
+		if err := s.createIndex(table, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) createIndex(table *schema.Schema, index *schema.Index) error {
+	_, err := s.raw(dialect.CreateIndexSQL(s.dialect, table.Name, index.Name, index.Columns(), index.Unique, index.Where)).Exec()
 	return err
 }
 
+// columnDefinition returns the column of field in CREATE TABLE,
+// primaryKey tells whether a primary key field declares it inline
+func columnDefinition(field *schema.Field, primaryKey bool) string {
+	def := field.MappingName + " " + field.Type
+	if field.Nullable {
+		def += " NULL"
+	}
+	constraint := strings.ToUpper(field.Constraint)
+	if field.NotNull && !strings.Contains(constraint, "NOT NULL") {
+		def += " NOT NULL"
+	}
+	if field.Default != "" && !strings.Contains(constraint, "DEFAULT") {
+		def += " DEFAULT " + field.Default
+	}
+	if field.Constraint != "" {
+		def += " " + field.Constraint
+	}
+	if primaryKey && field.PrimaryKey && !strings.Contains(constraint, "PRIMARY KEY") {
+		def += " PRIMARY KEY"
+	}
+	return def
+}
+
 func (s *Session) DropTable() error {
-	_, err := s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s", s.RefTable().Name)).Exec()
+	s = s.fork()
+	_, err := s.raw(fmt.Sprintf("DROP TABLE IF EXISTS %s", s.RefTable().Name)).Exec()
 	return err
 }
 
 func (s *Session) HasTable() bool {
+	s = s.fork()
 	sql, values := s.dialect.TableExistSQL(s.RefTable().Name)
-	row := s.Raw(sql, values...).QueryRow()
+	row := s.raw(sql, values...).QueryRow()
 	var tmp string
 	_ = row.Scan(&tmp)
 	return tmp == s.RefTable().Name
 }
+
+// HasIndex reports whether the index named name exists on the table of the model
+func (s *Session) HasIndex(name string) bool {
+	s = s.fork()
+	sql, values, ok := dialect.IndexExistSQL(s.dialect, s.RefTable().Name, name)
+	if !ok {
+		log.Errorf("dialect %s can't look up indexes", dialect.NameOf(s.dialect))
+		return false
+	}
+	row := s.raw(sql, values...).QueryRow()
+	var tmp string
+	_ = row.Scan(&tmp)
+	return tmp == name
+}
+
+// CreateIndex creates the index of the model named name, or the index of the field named name
+func (s *Session) CreateIndex(name string) error {
+	s = s.fork()
+	table := s.RefTable()
+	index := table.LookupIndex(name)
+	if index == nil {
+		return fmt.Errorf("table %s has no index %s", table.Name, name)
+	}
+	return s.createIndex(table, index)
+}
+
+// DropIndex drops the index named name, or the index of the field named name, if it exists
+func (s *Session) DropIndex(name string) error {
+	s = s.fork()
+	table := s.RefTable()
+	if index := table.LookupIndex(name); index != nil {
+		name = index.Name
+	}
+	_, err := s.raw(dialect.DropIndexSQL(s.dialect, table.Name, name)).Exec()
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/go-needle/log"
 	"github.com/go-needle/orm/dialect"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,58 @@ func TestSession_CreateTable(t *testing.T) {
 		t.Fatal("Failed to create table User")
 	}
 }
+
+func TestSession_Table(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Model(&User{}).Table("sys_user")
+	if s.Model(User{}).RefTable().Name != "sys_user" {
+		t.Fatal("failed to keep table name for the same model")
+	}
+	if New(db, d).Model(&User{}).RefTable().Name != "User" {
+		t.Fatal("table name leaked into the cached schema")
+	}
+}
+
+type Crew struct {
+	ID   int `orm:"pk"`
+	Name string
+}
+
+type Login struct {
+	ID     int    `orm:"pk"`
+	Email  string `orm:"uniqueIndex:idx_login_email"`
+	Age    int    `orm:"index:idx_login_age,where:Age > 18"`
+	CrewID int
+	Crew   Crew `orm:"onDelete:CASCADE"`
+}
+
+func TestSession_Indexes(t *testing.T) {
+	db, _ := sql.Open("sqlite3", "g.db")
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d).Model(&Login{})
+	_ = s.DropTable()
+	if err := s.CreateTable(); err != nil {
+		t.Fatal("failed to create table with indexes", err)
+	}
+	if !s.HasIndex("idx_login_email") || !s.HasIndex("idx_login_age") {
+		t.Fatal("failed to create indexes")
+	}
+	var ddl string
+	_ = s.Raw("SELECT sql FROM sqlite_master WHERE name = 'Login'").QueryRow().Scan(&ddl)
+	if !strings.Contains(ddl, "CONSTRAINT fk_Login_CrewID FOREIGN KEY (CrewID) REFERENCES Crew (ID) ON DELETE CASCADE") {
+		t.Fatal("failed to create foreign key, got", ddl)
+	}
+	if _, err := s.Insert(&Login{ID: 1, Email: "a@b.c"}, &Login{ID: 2, Email: "a@b.c"}); err == nil {
+		t.Fatal("expect an error for a duplicate unique key")
+	}
+	if err := s.DropIndex("Email"); err != nil || s.HasIndex("idx_login_email") {
+		t.Fatal("failed to drop index", err)
+	}
+	if err := s.CreateIndex("Email"); err != nil || !s.HasIndex("idx_login_email") {
+		t.Fatal("failed to create index", err)
+	}
+	if err := s.CreateIndex("Name"); err == nil {
+		t.Fatal("expect an error for an unknown index")
+	}
+}
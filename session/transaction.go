@@ -1,20 +1,47 @@
 package session
 
-import "github.com/go-needle/orm/log"
+import (
+	"database/sql"
+	"github.com/go-needle/orm/log"
+)
+
+// txCallbacks holds the callbacks queued on a transaction
+type txCallbacks struct {
+	afterCommit   []func()
+	afterRollback []func()
+}
 
 func (s *Session) Begin() (err error) {
 	log.Info("transaction begin")
-	if s.tx, err = s.db.Begin(); err != nil {
+	if s.tx, err = s.db.BeginTx(s.context(), nil); err != nil {
 		log.Error(err)
 		return
 	}
+	s.callbacks = &txCallbacks{}
 	return
 }
 
+// WithTx makes the session run its statements in tx, a transaction begun outside of it,
+// e.g. on a connection set up beforehand. Commit and Rollback end tx.
+func (s *Session) WithTx(tx *sql.Tx) *Session {
+	s = s.getInstance()
+	s.tx = tx
+	s.callbacks = &txCallbacks{}
+	return s
+}
+
 func (s *Session) Commit() (err error) {
 	log.Info("transaction commit")
 	if err = s.tx.Commit(); err != nil {
 		log.Error(err)
+		return
+	}
+	callbacks := s.callbacks
+	s.callbacks = nil
+	if callbacks != nil {
+		for _, f := range callbacks.afterCommit {
+			f()
+		}
 	}
 	return
 }
@@ -23,6 +50,33 @@ func (s *Session) Rollback() (err error) {
 	log.Info("transaction rollback")
 	if err = s.tx.Rollback(); err != nil {
 		log.Error(err)
+		return
+	}
+	callbacks := s.callbacks
+	s.callbacks = nil
+	if callbacks != nil {
+		for _, f := range callbacks.afterRollback {
+			f()
+		}
 	}
 	return
 }
+
+// AfterCommit registers f to run once the current transaction commits.
+// Without a transaction the statements are already committed, so f runs immediately.
+func (s *Session) AfterCommit(f func()) {
+	if s.callbacks == nil {
+		f()
+		return
+	}
+	s.callbacks.afterCommit = append(s.callbacks.afterCommit, f)
+}
+
+// AfterRollback registers f to run once the current transaction rolls back.
+// Without a transaction there is nothing to roll back, so f is dropped.
+func (s *Session) AfterRollback(f func()) {
+	if s.callbacks == nil {
+		return
+	}
+	s.callbacks.afterRollback = append(s.callbacks.afterRollback, f)
+}